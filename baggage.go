@@ -0,0 +1,48 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import "context"
+
+// Baggage is a read-only view of the (W3C) baggage entries propagated with a request,
+// to be implemented by an adapter of the tracing library in use.
+type Baggage interface {
+	Value(key string) (string, bool)
+}
+
+// BaggageFromContext returns the Baggage of ctx, or nil.
+//
+// By default it returns the Baggage stored by ContextWithBaggage;
+// replace it (at init) to read the baggage of a tracing library, such as OpenTelemetry.
+var BaggageFromContext = func(ctx context.Context) Baggage {
+	b, _ := ctx.Value(baggageCtxKey{}).(Baggage)
+	return b
+}
+
+type baggageCtxKey struct{}
+
+// ContextWithBaggage returns a Context carrying b, for BaggageFromContext.
+func ContextWithBaggage(ctx context.Context, b Baggage) context.Context {
+	return context.WithValue(ctx, baggageCtxKey{}, b)
+}
+
+// WithBaggage returns a copy of the ULog instance with the given baggage entries of ctx (see BaggageFromContext)
+// as fields, under their own keys. The missing entries are skipped.
+func (u ULog) WithBaggage(ctx context.Context, keys ...string) ULog {
+	b := BaggageFromContext(ctx)
+	if b == nil {
+		return u
+	}
+	fields := make([]Field, 0, 2*len(keys))
+	for _, k := range keys {
+		if v, ok := b.Value(k); ok {
+			fields = append(fields, k, v)
+		}
+	}
+	if len(fields) == 0 {
+		return u
+	}
+	return u.With(fields...)
+}
@@ -0,0 +1,36 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+type mockBaggage map[string]string
+
+func (m mockBaggage) Value(key string) (string, bool) { v, ok := m[key]; return v, ok }
+
+func TestWithBaggage(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+	ctx := ulog.ContextWithBaggage(context.Background(),
+		mockBaggage{"tenant": "acme", "request_id": "r1", "secret": "x"})
+
+	logger.WithBaggage(ctx, "tenant", "request_id", "missing").Write("with baggage")
+	logLine := parseLogLine(buffer.Bytes())
+	require.Equal(t, "acme", logLine["tenant"])
+	require.Equal(t, "r1", logLine["request_id"])
+	require.NotContains(t, logLine, "secret")
+	require.NotContains(t, logLine, "missing")
+
+	buffer.Reset()
+	logger.WithBaggage(context.Background(), "tenant").Write("without baggage")
+	require.Len(t, parseLogLine(buffer.Bytes()), 2)
+}
@@ -6,7 +6,9 @@
 package ulog_test
 
 import (
+	"io"
 	"io/ioutil"
+	"strconv"
 	"testing"
 	"time"
 
@@ -17,9 +19,15 @@ var (
 	fakeMessage = "Test logging, but use a somewhat realistic message length."
 )
 
+// nopWriter discards everything, like ioutil.Discard - but it is not short-circuited by ULog,
+// so the formatting is measured.
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) { return len(p), nil }
+
 func BenchmarkLogEmpty(b *testing.B) {
 	logger := ulog.New()
-	logger.Writer = ioutil.Discard
+	logger.Writer = nopWriter{}
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -29,7 +37,8 @@ func BenchmarkLogEmpty(b *testing.B) {
 }
 
 func BenchmarkInfo(b *testing.B) {
-	logger := ulog.WithWriter(ioutil.Discard)
+	b.ReportAllocs()
+	logger := ulog.WithWriter(nopWriter{})
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -39,7 +48,7 @@ func BenchmarkInfo(b *testing.B) {
 }
 
 func BenchmarkContextFields(b *testing.B) {
-	logger := ulog.WithWriter(ioutil.Discard).With(
+	logger := ulog.WithWriter(nopWriter{}).With(
 		"string", "four!",
 		"time", time.Time{},
 		"int", 123,
@@ -53,7 +62,8 @@ func BenchmarkContextFields(b *testing.B) {
 }
 
 func BenchmarkContextAppend(b *testing.B) {
-	logger := ulog.WithWriter(ioutil.Discard).With("foo", "bar")
+	b.ReportAllocs()
+	logger := ulog.WithWriter(nopWriter{}).With("foo", "bar")
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -63,7 +73,8 @@ func BenchmarkContextAppend(b *testing.B) {
 }
 
 func BenchmarkLogFields(b *testing.B) {
-	logger := ulog.WithWriter(ioutil.Discard)
+	b.ReportAllocs()
+	logger := ulog.WithWriter(nopWriter{})
 	b.ResetTimer()
 	b.RunParallel(func(pb *testing.PB) {
 		for pb.Next() {
@@ -75,3 +86,146 @@ func BenchmarkLogFields(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkInfoWithContextField(b *testing.B) {
+	logger := ulog.WithWriter(nopWriter{}).With("foo", "bar")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			logger.Write(fakeMessage)
+		}
+	})
+}
+
+func BenchmarkDedup(b *testing.B) {
+	fields := make([]ulog.Field, 0, 100)
+	for i := 0; i < 50; i++ {
+		fields = append(fields, "field"+strconv.Itoa(i), i)
+	}
+	for _, tc := range []struct {
+		name   string
+		logger ulog.ULog
+	}{
+		{"dedup", ulog.WithWriter(nopWriter{})},
+		{"nodedup", ulog.WithWriter(nopWriter{}).WithNoDedup()},
+	} {
+		logger := tc.logger
+		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.Write(fakeMessage, fields...)
+			}
+		})
+	}
+}
+
+func BenchmarkContextSizes(b *testing.B) {
+	for _, n := range []int{8, 32, 128} {
+		fields := make([]ulog.Field, 0, 2*n)
+		for i := 0; i < n; i++ {
+			fields = append(fields, "field"+strconv.Itoa(i), i)
+		}
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			logger := ulog.WithWriter(nopWriter{}).With(fields...)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.With("extra", i).Write(fakeMessage, fields[:n]...)
+			}
+		})
+	}
+}
+
+func BenchmarkTimeEncoder(b *testing.B) {
+	for _, enc := range []struct {
+		Name string
+		Enc  func([]byte, time.Time) []byte
+	}{
+		{"default", nil},
+		{"DefaultTimeEncoder", ulog.DefaultTimeEncoder},
+		{"seconds", func(dst []byte, t time.Time) []byte { return strconv.AppendInt(dst, t.Unix(), 10) }},
+	} {
+		b.Run(enc.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			logger := ulog.WithWriter(nopWriter{})
+			if enc.Enc != nil {
+				logger = logger.WithTimeEncoder(enc.Enc)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Write(fakeMessage)
+			}
+		})
+	}
+}
+
+func BenchmarkDiscard(b *testing.B) {
+	for _, w := range []struct {
+		Name   string
+		Writer io.Writer
+	}{{"ioutil.Discard", ioutil.Discard}, {"nopWriter", nopWriter{}}} {
+		b.Run(w.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			logger := ulog.WithWriter(w.Writer).With("foo", "bar")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Write(fakeMessage, "int", 123, "float", -2.203230293249593)
+			}
+		})
+	}
+}
+
+// BenchmarkFieldsAllocs compares the allocations of the field-less fast path
+// (which does not touch the field and encoder pools) with a single field.
+func BenchmarkFieldsAllocs(b *testing.B) {
+	logger := ulog.New()
+	logger.Writer = nopWriter{}
+	for _, bm := range []struct {
+		Name   string
+		Logger ulog.ULog
+	}{
+		{"none", logger},
+		{"one", logger.With("key", "value")},
+	} {
+		logger := bm.Logger
+		b.Run(bm.Name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger.Write("message")
+			}
+		})
+	}
+}
+
+func BenchmarkDedupMap(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		logger ulog.ULog
+	}{
+		{"linear", ulog.WithWriter(nopWriter{})},
+		{"map", ulog.WithWriter(nopWriter{}).WithDedupMap()},
+	} {
+		tc := tc
+		b.Run(tc.name+"/with", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				logger := tc.logger
+				for j := 0; j < 40; j++ {
+					logger = logger.With("field"+strconv.Itoa(j), j)
+				}
+				logger.Write(fakeMessage, "field1", "x", "new", 1)
+			}
+		})
+		b.Run(tc.name+"/write", func(b *testing.B) {
+			logger := tc.logger
+			for j := 0; j < 40; j++ {
+				logger = logger.With("field"+strconv.Itoa(j), j)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				logger.Write(fakeMessage, "field1", "x", "new", 1)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+const (
+	// CallersKey is the key of the call chain, with WithCallerStack.
+	CallersKey = "callers"
+	// CallerKey is the key of the call site, with WithCallerOnError.
+	CallerKey = "caller"
+	// maxCallerDepth bounds the depth of WithCallerStack.
+	maxCallerDepth = 32
+)
+
+// pkgPrefix is the prefix of the functions of this package, skipped by callerStack.
+var pkgPrefix = reflect.TypeOf(ULog{}).PkgPath() + "."
+
+// WithCallerStack returns a copy of the ULog instance which writes the depth (at most 32) innermost frames
+// of the call chain leading to the Write call (as file:line:function) under CallersKey in every line -
+// for understanding how a function was reached.
+//
+// This is not cheap, so use it for debugging only.
+func (u ULog) WithCallerStack(depth int) ULog {
+	if depth > maxCallerDepth {
+		depth = maxCallerDepth
+	}
+	v := u
+	v.callerDepth = depth
+	return v
+}
+
+// callerStack returns the depth innermost frames of the call stack, outside of this package.
+func callerStack(depth int) []string {
+	var pc [maxCallerDepth + 8]uintptr
+	n := runtime.Callers(2, pc[:])
+	frames := runtime.CallersFrames(pc[:n])
+	callers := make([]string, 0, depth)
+	for len(callers) < depth {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, pkgPrefix) {
+			callers = append(callers, formatFrame(frame))
+		}
+		if !more {
+			break
+		}
+	}
+	return callers
+}
+
+// WithCallerOnError returns a copy of the ULog instance which writes the call site of Write
+// (as file:line:function) under CallerKey - but only in the error lines,
+// which have at least Error level (see WithLevel), or a non-nil error under the "error" key.
+//
+// This spares the cost of the caller lookup for the other lines.
+func (u ULog) WithCallerOnError() ULog {
+	v := u
+	v.callerOnError = true
+	return v
+}
+
+// isErrorLine reports whether the line with the fields (and the context fields) is an error line,
+// see WithCallerOnError.
+func (u ULog) isErrorLine(fields []Field) bool {
+	levelKey := u.getLevelKey()
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch k, _ := fields[i].(string); k {
+		case levelKey:
+			switch x := fields[i+1].(type) {
+			case Level:
+				if x >= Error {
+					return true
+				}
+			case string:
+				if isErrorLevel(x) {
+					return true
+				}
+			}
+		case "error":
+			if err, ok := fields[i+1].(error); ok && err != nil {
+				return true
+			}
+		}
+	}
+	if i := u.fields.Index(encodeKey(levelKey)); i >= 0 && isErrorLevel(unquoteKey(u.fields[i].Value())) {
+		return true
+	}
+	i := u.fields.Index(`"error"`)
+	return i >= 0 && u.fields[i].Value() != "null"
+}
+
+// isErrorLevel reports whether the level name s (canonical, or GCP severity) is at least Error.
+func isErrorLevel(s string) bool {
+	return ParseLevel(s) >= Error || parseGCPSeverity(s) >= Error
+}
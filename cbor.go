@@ -0,0 +1,54 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+//go:build cbor
+// +build cbor
+
+package ulog
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// FormatCBOR writes each line as a CBOR map, with the same fields as FormatJSON would
+// (without the line prefix).
+//
+// This needs the "cbor" build tag.
+const FormatCBOR = Format(1)
+
+func init() {
+	formatEncoders[FormatCBOR] = func(line []byte) ([]byte, error) {
+		dec := stdjson.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		return cbor.Marshal(cborValue(v))
+	}
+}
+
+// cborValue converts the json.Numbers in v to int64 or float64.
+func cborValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case stdjson.Number:
+		if i, err := x.Int64(); err == nil {
+			return i
+		}
+		f, _ := x.Float64()
+		return f
+	case map[string]interface{}:
+		for k, e := range x {
+			x[k] = cborValue(e)
+		}
+	case []interface{}:
+		for i, e := range x {
+			x[i] = cborValue(e)
+		}
+	}
+	return v
+}
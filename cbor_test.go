@@ -0,0 +1,73 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+//go:build cbor
+// +build cbor
+
+package ulog_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatCBOR(t *testing.T) {
+	var jsBuf, cborBuf bytes.Buffer
+	clock := func() time.Time { return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC) }
+	fields := []ulog.Field{"s", "str", "i", 42, "f", 1.5, "b", true, "n", nil,
+		"m", map[string]interface{}{"a": []int{1, 2}}}
+
+	ulog.WithWriter(&jsBuf).WithClock(clock).With("ctx", 1).Write("test", fields...)
+	ulog.WithWriter(&cborBuf).WithClock(clock).WithFormat(ulog.FormatCBOR).With("ctx", 1).Write("test", fields...)
+	require.NotEqual(t, byte('{'), cborBuf.Bytes()[0])
+
+	var got map[string]interface{}
+	dm, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+	require.NoError(t, err)
+	require.NoError(t, dm.Unmarshal(cborBuf.Bytes(), &got))
+
+	want := parseLogLine(jsBuf.Bytes())
+	require.Len(t, got, len(want))
+	for k, v := range want {
+		switch x := v.(type) {
+		case float64:
+			require.EqualValues(t, x, toFloat(got[k]), k)
+		case map[string]interface{}:
+			require.EqualValues(t, x["a"].([]interface{})[0], toFloat(got[k].(map[string]interface{})["a"].([]interface{})[0]), k)
+			require.Len(t, got[k].(map[string]interface{})["a"], 2)
+		default:
+			require.Equal(t, v, got[k], k)
+		}
+	}
+}
+
+func toFloat(v interface{}) float64 {
+	switch x := v.(type) {
+	case uint64:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return -1
+}
+
+func TestFormatCBORLinePrefix(t *testing.T) {
+	var buf, sink bytes.Buffer
+	ulog.WithWriter(&buf).WithErrorSink(&sink).WithFormat(ulog.FormatCBOR).WithLinePrefix("@app").
+		Write("prefixed", "a", 1)
+	require.Zero(t, sink.Len(), sink.String())
+
+	var got map[string]interface{}
+	require.NoError(t, cbor.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, "prefixed", got[ulog.DefaultMessageKey])
+	require.EqualValues(t, 1, got["a"])
+}
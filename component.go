@@ -0,0 +1,62 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+const (
+	// DefaultComponentKey is the default key of the WithComponent field.
+	DefaultComponentKey = "component"
+	// ComponentSeparator separates the nested component names.
+	ComponentSeparator = "/"
+)
+
+// WithComponentKey returns a copy of the ULog instance which uses the provided key for WithComponent.
+func (u ULog) WithComponentKey(key string) ULog {
+	v := u
+	if key == "" {
+		key = DefaultComponentKey
+	}
+	v.componentKey = key
+	return v
+}
+
+// WithComponent returns a copy of the ULog instance with the component field set to name.
+//
+// Chained calls nest the names: WithComponent("parent").WithComponent("child") logs "parent/child".
+func (u ULog) WithComponent(name string) ULog {
+	v := u
+	if v.component != "" {
+		name = v.component + ComponentSeparator + name
+	}
+	v.component = name
+	return v.With(v.getComponentKey(), name)
+}
+
+func (u ULog) getComponentKey() string {
+	if u.componentKey == "" {
+		return DefaultComponentKey
+	}
+	return u.componentKey
+}
+
+// ServiceKey is the key of the WithService field.
+const ServiceKey = "service"
+
+// WithService returns a copy of the ULog instance with the service name field set, encoded once.
+//
+// Chained calls replace the name, even with WithNoDedup.
+func (u ULog) WithService(name string) ULog {
+	var ff encodedFields
+	ff.AppendFields([]Field{ServiceKey, name}, u.opts)
+	if len(ff) == 0 {
+		return u
+	}
+	if i := u.fields.Index(ff[0].Key()); i >= 0 {
+		v := u
+		v.fields = append(encodedFields(nil), u.fields...)
+		v.fields[i] = ff[0]
+		return v
+	}
+	return u.With(ServiceKey, name)
+}
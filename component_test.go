@@ -0,0 +1,52 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithComponent(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+
+	logger.WithComponent("db").Write("single")
+	require.Equal(t, "db", parseLogLine(buffer.Bytes())[ulog.DefaultComponentKey])
+
+	buffer.Reset()
+	logger.WithComponent("db").WithComponent("pool").Write("nested")
+	logLine := parseLogLine(buffer.Bytes())
+	require.Equal(t, "db/pool", logLine[ulog.DefaultComponentKey])
+	require.Len(t, logLine, 3)
+
+	buffer.Reset()
+	logger.WithComponentKey("lib").WithComponent("http").Write("custom")
+	logLine = parseLogLine(buffer.Bytes())
+	require.Equal(t, "http", logLine["lib"])
+	require.NotContains(t, logLine, ulog.DefaultComponentKey)
+}
+
+func TestWithService(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+
+	logger.WithService("billing").Write("single")
+	logLine := parseLogLine(buffer.Bytes())
+	require.Equal(t, "billing", logLine[ulog.ServiceKey])
+	require.Len(t, logLine, 3)
+
+	for _, logger := range []ulog.ULog{logger, logger.WithNoDedup()} {
+		buffer.Reset()
+		logger.WithService("billing").With("a", 1).WithService("invoicing").Write("chained")
+		require.Equal(t, 1, bytes.Count(buffer.Bytes(), []byte(`"service"`)), buffer.String())
+		logLine = parseLogLine(buffer.Bytes())
+		require.Equal(t, "invoicing", logLine[ulog.ServiceKey])
+		require.Equal(t, 1.0, logLine["a"])
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// connBacklog is the maximum number of lines kept while the connection is down.
+	connBacklog = 64
+
+	minRedialBackoff = 100 * time.Millisecond
+	maxRedialBackoff = 30 * time.Second
+)
+
+// NewConnWriter returns an io.WriteCloser which writes each line to a connection got from dial,
+// and transparently redials on write errors.
+//
+// While the connection is down, the last few lines are kept and sent after reconnecting, in order.
+// Each Write dials at most once, and after a failed dial the redials are backed off exponentially
+// (up to 30s) - in the meantime Write only keeps the line, and returns the last dial error.
+func NewConnWriter(dial func() (net.Conn, error)) io.WriteCloser {
+	return &connWriter{dial: dial, now: time.Now}
+}
+
+type connWriter struct {
+	dial func() (net.Conn, error)
+	now  func() time.Time
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending [][]byte
+
+	dialErr  error
+	backoff  time.Duration
+	nextDial time.Time
+}
+
+func (cw *connWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if len(cw.pending) == connBacklog {
+		// Drop the oldest line.
+		copy(cw.pending, cw.pending[1:])
+		cw.pending = cw.pending[:len(cw.pending)-1]
+	}
+	cw.pending = append(cw.pending, append(make([]byte, 0, len(p)), p...))
+	return len(p), cw.flush()
+}
+
+// flush the pending lines, dialing at most once. Must be called with mu held.
+func (cw *connWriter) flush() error {
+	if cw.conn == nil {
+		now := cw.now()
+		if now.Before(cw.nextDial) {
+			return cw.dialErr
+		}
+		conn, err := cw.dial()
+		if err != nil {
+			if cw.backoff *= 2; cw.backoff < minRedialBackoff {
+				cw.backoff = minRedialBackoff
+			} else if cw.backoff > maxRedialBackoff {
+				cw.backoff = maxRedialBackoff
+			}
+			cw.dialErr, cw.nextDial = err, now.Add(cw.backoff)
+			return err
+		}
+		cw.conn, cw.dialErr, cw.backoff = conn, nil, 0
+	}
+	for len(cw.pending) != 0 {
+		if _, err := cw.conn.Write(cw.pending[0]); err != nil {
+			// The line is sent again as a whole on the next connection, to not tear it.
+			// The next Write may redial immediately.
+			cw.conn.Close()
+			cw.conn = nil
+			return err
+		}
+		cw.pending[0] = nil
+		cw.pending = cw.pending[1:]
+	}
+	return nil
+}
+
+// Close the underlying connection. Pending lines are dropped.
+func (cw *connWriter) Close() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	cw.pending = nil
+	if cw.conn == nil {
+		return nil
+	}
+	err := cw.conn.Close()
+	cw.conn = nil
+	return err
+}
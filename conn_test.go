@@ -0,0 +1,111 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type flakyConn struct {
+	net.Conn
+	buf *bytes.Buffer
+	// failures is the number of writes to fail, after writing partial bytes.
+	failures *int
+	partial  int
+}
+
+func (c flakyConn) Write(p []byte) (int, error) {
+	if *c.failures > 0 {
+		*c.failures--
+		n, _ := c.buf.Write(p[:c.partial])
+		return n, errors.New("broken pipe")
+	}
+	return c.buf.Write(p)
+}
+func (c flakyConn) Close() error { return nil }
+
+func TestConnWriter(t *testing.T) {
+	// The bytes received on each connection.
+	var conns []*bytes.Buffer
+	var dials, dialFailures, writeFailures int
+	dial := func() (net.Conn, error) {
+		dials++
+		if dialFailures > 0 {
+			dialFailures--
+			return nil, errors.New("connection refused")
+		}
+		conns = append(conns, &bytes.Buffer{})
+		return flakyConn{buf: conns[len(conns)-1], failures: &writeFailures, partial: 5}, nil
+	}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	cw := NewConnWriter(dial).(*connWriter)
+	cw.now = func() time.Time { return now }
+	logger := WithWriter(cw)
+
+	logger.Write("0")
+	writeFailures, dialFailures = 1, 2
+	dials = 0
+	for i := 1; i < 5; i++ {
+		logger.Write(strconv.Itoa(i))
+	}
+	// 1: partial write fails; 2: dial fails; 3, 4: backoff.
+	if dials != 1 {
+		t.Errorf("got %d dials, wanted 1", dials)
+	}
+	now = now.Add(minRedialBackoff)
+	logger.Write("5") // dial fails, backoff doubles
+	now = now.Add(minRedialBackoff)
+	logger.Write("6") // still backing off
+	if dials != 2 {
+		t.Errorf("got %d dials, wanted 2", dials)
+	}
+	now = now.Add(minRedialBackoff)
+	logger.Write("7")
+	if dials != 3 {
+		t.Errorf("got %d dials, wanted 3", dials)
+	}
+
+	if len(conns) != 2 {
+		t.Fatalf("got %d connections, wanted 2", len(conns))
+	}
+	// The broken connection ends with the partially written line, which the receiver drops;
+	// but each connection must hold complete lines only, before that.
+	var received bytes.Buffer
+	for i, conn := range conns {
+		b := conn.Bytes()
+		if i < len(conns)-1 {
+			b = b[:bytes.LastIndexByte(b, '\n')+1]
+		} else if len(b) != 0 && b[len(b)-1] != '\n' {
+			t.Errorf("%d. connection ends with a partial line: %q", i, b)
+		}
+		for _, line := range bytes.SplitAfter(b, []byte{'\n'}) {
+			if len(line) != 0 && (line[0] != '{' || !bytes.HasSuffix(line, []byte("}\n"))) {
+				t.Errorf("%d. connection got a torn line: %q", i, line)
+			}
+		}
+		received.Write(b)
+	}
+	dec := NewDecoder(&received)
+	for i := 0; i < 8; i++ {
+		e, err := dec.Decode()
+		if err != nil {
+			t.Fatalf("%d: %+v\n%s", i, err, received.String())
+		}
+		if got, want := e.Str(DefaultMessageKey), strconv.Itoa(i); got != want {
+			t.Errorf("%d. got %q, wanted %q", i, got, want)
+		}
+	}
+	if received.Len() != 0 {
+		t.Errorf("remaining: %q", received.String())
+	}
+	if err := cw.Close(); err != nil {
+		t.Error(err)
+	}
+}
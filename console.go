@@ -0,0 +1,131 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// consoleTimeFormat is the timestamp layout of the console lines.
+const consoleTimeFormat = "15:04:05.000"
+
+// ANSI escape sequences for the colored console lines.
+const (
+	colorReset = "\x1b[0m"
+	colorKey   = "\x1b[36m"
+)
+
+var levelColors = [...]string{Debug: "\x1b[90m", Info: "\x1b[32m", Warn: "\x1b[33m", Error: "\x1b[31m"}
+
+// WithConsoleTee returns a copy of the ULog instance which also writes each line to w in a human-readable form,
+// as "15:04:05.000 LEVEL message key=value ...", while the JSON is written to the Writer as usual.
+//
+// The level is taken from the level field (see WithLevel), and the output is colored iff w is a terminal.
+// The message, keys and values with control characters (such as escape sequences) are quoted.
+func (u ULog) WithConsoleTee(w io.Writer) ULog {
+	return u.WithHook(consoleHook(w, u.getLevelKey(), isTerminal(w)))
+}
+
+// isTerminal reports whether w is a character device, such as a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// consoleHook returns a hook writing the human-readable form of the lines to w.
+func consoleHook(w io.Writer, levelKey string, color bool) func(HookEntry) {
+	levelKey = strconv.Quote(levelKey)
+	return func(e HookEntry) {
+		var buf bytes.Buffer
+		buf.WriteString(e.Time.Format(consoleTimeFormat))
+		level := -1
+		for i := 0; i < e.NumFields(); i++ {
+			if k, v := e.Field(i); k == levelKey {
+				if l := ParseLevel(unquoteConsole(v)); l != 0 {
+					level = i
+					buf.WriteByte(' ')
+					if color {
+						buf.WriteString(levelColors[l])
+					}
+					buf.WriteString(strings.ToUpper(l.String()))
+					if color {
+						buf.WriteString(colorReset)
+					}
+				}
+				break
+			}
+		}
+		if e.Message != "" {
+			buf.WriteByte(' ')
+			buf.WriteString(consoleText(e.Message))
+		}
+		for i := 0; i < e.NumFields(); i++ {
+			if i == level {
+				continue
+			}
+			k, v := e.Field(i)
+			buf.WriteByte(' ')
+			if color {
+				buf.WriteString(colorKey)
+			}
+			buf.WriteString(consoleText(unquoteConsole(k)))
+			if color {
+				buf.WriteString(colorReset)
+			}
+			buf.WriteByte('=')
+			buf.WriteString(consoleValue(v))
+		}
+		buf.WriteByte('\n')
+		_, _ = w.Write(buf.Bytes())
+	}
+}
+
+// unquoteConsole returns the string of the JSON-encoded s, or s if it is not a JSON string.
+func unquoteConsole(s string) string {
+	if len(s) < 2 || s[0] != '"' {
+		return s
+	}
+	var u string
+	if err := stdjson.Unmarshal([]byte(s), &u); err != nil {
+		return s
+	}
+	return u
+}
+
+// consoleValue returns the JSON-encoded value v for the console: strings unquoted, if that is unambiguous.
+func consoleValue(v string) string {
+	if len(v) == 0 || v[0] != '"' {
+		return v
+	}
+	s := unquoteConsole(v)
+	if s == "" || strings.ContainsAny(s, " =\"") || hasControl(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// consoleText returns s quoted if it has control characters (such as escape sequences,
+// which could control the terminal), else as is.
+func consoleText(s string) string {
+	if hasControl(s) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// hasControl reports whether s has control characters (including line breaks).
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) >= 0
+}
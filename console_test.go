@@ -0,0 +1,43 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithConsoleTee(t *testing.T) {
+	now := time.Date(2021, 2, 3, 4, 5, 6, 789000000, time.UTC)
+	var jsonBuf, console bytes.Buffer
+	logger := ulog.WithWriter(&jsonBuf).WithClock(func() time.Time { return now }).
+		WithConsoleTee(&console)
+
+	logger.WithLevel(ulog.Warn).Write("disk is full", "path", "/var", "free", 0, "note", "no space left", "empty", "")
+	logLine := parseLogLine(jsonBuf.Bytes())
+	require.Equal(t, "disk is full", logLine["msg"])
+	require.Equal(t, "warn", logLine["level"])
+	require.Equal(t, "/var", logLine["path"])
+	require.Equal(t, `04:05:06.789 WARN disk is full path=/var free=0 note="no space left" empty=""`+"\n", console.String())
+
+	console.Reset()
+	logger.Write("", "nested", map[string]int{"a": 1})
+	require.Equal(t, `04:05:06.789 nested={"a":1}`+"\n", console.String())
+}
+
+func TestConsoleTeeEscapes(t *testing.T) {
+	now := time.Date(2021, 2, 3, 4, 5, 6, 789000000, time.UTC)
+	var console bytes.Buffer
+	logger := ulog.WithWriter(&bytes.Buffer{}).WithClock(func() time.Time { return now }).
+		WithConsoleTee(&console)
+
+	// The escape sequences do not reach the terminal.
+	logger.Write("\x1b[2Jcleared", "k\x1b[31m", "\x1b]0;title\a", "csi", "\u009b2J")
+	require.Equal(t, `04:05:06.789 "\x1b[2Jcleared" "k\x1b[31m"="\x1b]0;title\a" csi="\u009b2J"`+"\n", console.String())
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	stdjson "encoding/json"
+	"io"
+	"math"
+	"time"
+)
+
+// Entry is a decoded log line.
+type Entry map[string]interface{}
+
+// Decoder reads Entries from a stream of log lines.
+type Decoder struct {
+	dec *stdjson.Decoder
+}
+
+// NewDecoder returns a Decoder reading from r.
+//
+// Numbers are decoded as json.Number, to keep large integers exact.
+func NewDecoder(r io.Reader) *Decoder {
+	dec := stdjson.NewDecoder(r)
+	dec.UseNumber()
+	return &Decoder{dec: dec}
+}
+
+// Decode the next Entry. Returns io.EOF at the end of the stream.
+func (d *Decoder) Decode() (Entry, error) {
+	var e Entry
+	if err := d.dec.Decode(&e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Str returns the string value of key, or "" if it is missing or not a string.
+func (e Entry) Str(key string) string {
+	s, _ := e[key].(string)
+	return s
+}
+
+// Int returns the integer value of key.
+//
+// For float64 values (such as in an Entry not decoded by Decoder), only integral values are accepted.
+func (e Entry) Int(key string) (int64, bool) {
+	switch x := e[key].(type) {
+	case float64:
+		if x != math.Trunc(x) || x < math.MinInt64 || x >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(x), true
+	case stdjson.Number:
+		i, err := x.Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// Float returns the numeric value of key.
+func (e Entry) Float(key string) (float64, bool) {
+	switch x := e[key].(type) {
+	case float64:
+		return x, true
+	case stdjson.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Bool returns the boolean value of key.
+func (e Entry) Bool(key string) (bool, bool) {
+	b, ok := e[key].(bool)
+	return b, ok
+}
+
+// Time returns the RFC3339 timestamp value of key.
+func (e Entry) Time(key string) (time.Time, bool) {
+	s, ok := e[key].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	return t, err == nil
+}
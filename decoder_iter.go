@@ -0,0 +1,34 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.23
+// +build go1.23
+
+package ulog
+
+import (
+	"io"
+	"iter"
+)
+
+// All returns an iterator over the remaining Entries, for
+//
+//	for e, err := range dec.All() {
+//
+// The sequence ends at the end of the stream (io.EOF is not yielded).
+// A decoding error is yielded with a nil Entry, and ends the sequence,
+// as the stream cannot be resynchronized after a malformed line.
+func (d *Decoder) All() iter.Seq2[Entry, error] {
+	return func(yield func(Entry, error) bool) {
+		for {
+			e, err := d.Decode()
+			if err == io.EOF {
+				return
+			}
+			if !yield(e, err) || err != nil {
+				return
+			}
+		}
+	}
+}
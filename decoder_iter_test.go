@@ -0,0 +1,65 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+//go:build go1.23
+// +build go1.23
+
+package ulog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderAll(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+	for _, msg := range []string{"first", "second", "third"} {
+		logger.Write(msg)
+	}
+
+	var msgs []string
+	for e, err := range ulog.NewDecoder(&buffer).All() {
+		require.NoError(t, err)
+		msgs = append(msgs, e.Str(ulog.DefaultMessageKey))
+	}
+	require.Equal(t, []string{"first", "second", "third"}, msgs)
+
+	// Breaking out of the loop early.
+	for _, msg := range []string{"first", "second"} {
+		logger.Write(msg)
+	}
+	dec := ulog.NewDecoder(&buffer)
+	for e := range dec.All() {
+		require.Equal(t, "first", e.Str(ulog.DefaultMessageKey))
+		break
+	}
+	e, err := dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, "second", e.Str(ulog.DefaultMessageKey))
+}
+
+func TestDecoderAllMalformed(t *testing.T) {
+	var buffer bytes.Buffer
+	ulog.WithWriter(&buffer).Write("first")
+	buffer.WriteString("{ \"msg\": oops }\n")
+	ulog.WithWriter(&buffer).Write("unreached")
+
+	var msgs []string
+	var errs []error
+	for e, err := range ulog.NewDecoder(strings.NewReader(buffer.String())).All() {
+		if err != nil {
+			require.Nil(t, e)
+			errs = append(errs, err)
+			continue
+		}
+		msgs = append(msgs, e.Str(ulog.DefaultMessageKey))
+	}
+	require.Equal(t, []string{"first"}, msgs)
+	require.Len(t, errs, 1)
+}
@@ -0,0 +1,64 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoderEntry(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+	at := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	logger.Write("first", "int", 42, "big", int64(9007199254740993), "float", 1.5, "bool", true, "at", at)
+	logger.Write("second")
+
+	dec := ulog.NewDecoder(&buffer)
+	e, err := dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, "first", e.Str(ulog.DefaultMessageKey))
+	require.Equal(t, "", e.Str("int"))
+
+	i, ok := e.Int("int")
+	require.True(t, ok)
+	require.Equal(t, int64(42), i)
+	_, ok = e.Int("float")
+	require.False(t, ok)
+	i, ok = e.Int("big")
+	require.True(t, ok)
+	require.Equal(t, int64(9007199254740993), i)
+	i, ok = ulog.Entry{"f": float64(3)}.Int("f")
+	require.True(t, ok)
+	require.Equal(t, int64(3), i)
+
+	f, ok := e.Float("float")
+	require.True(t, ok)
+	require.Equal(t, 1.5, f)
+
+	b, ok := e.Bool("bool")
+	require.True(t, ok)
+	require.True(t, b)
+	_, ok = e.Bool("missing")
+	require.False(t, ok)
+
+	ts, ok := e.Time("at")
+	require.True(t, ok)
+	require.True(t, at.Equal(ts))
+	ts, ok = e.Time(ulog.DefaultTimestampKey)
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now(), ts, time.Second)
+
+	e, err = dec.Decode()
+	require.NoError(t, err)
+	require.Equal(t, "second", e.Str(ulog.DefaultMessageKey))
+	_, err = dec.Decode()
+	require.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,102 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RepeatedKey is the key of the number of suppressed duplicates, in the summary line of NewDedupWriter.
+const RepeatedKey = "repeated"
+
+// NewDedupWriter returns an io.Writer which suppresses the lines identical to the previous one,
+// for window after its first occurrence, as when multiple loggers feed one sink.
+//
+// The number of the suppressed lines is written in a "repeated N" summary line (with RepeatedKey: N)
+// before the next distinct line (or the next occurrence after window).
+//
+// The lines are compared without the value of their first field, which is the timestamp
+// in the lines of ULog (other lines must be byte-for-byte identical). The other time fields
+// (such as of WithDualTimestamp or WithElapsed) still make the lines differ.
+func NewDedupWriter(w io.Writer, window time.Duration) io.Writer {
+	return &dedupWriter{w: w, window: window, now: time.Now}
+}
+
+type dedupWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	now      func() time.Time
+	window   time.Duration
+	last     []byte
+	first    time.Time
+	repeated int
+}
+
+func (dw *dedupWriter) Write(p []byte) (int, error) {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	now := dw.now()
+	if dw.last != nil && sameLine(p, dw.last) && now.Sub(dw.first) < dw.window {
+		dw.repeated++
+		return len(p), nil
+	}
+	if dw.repeated != 0 {
+		n := dw.repeated
+		dw.repeated = 0
+		WithWriter(dw.w).WithClock(func() time.Time { return now }).
+			Write("repeated "+strconv.Itoa(n), RepeatedKey, n)
+	}
+	dw.last, dw.first = append(dw.last[:0], p...), now
+	return dw.w.Write(p)
+}
+
+// sameLine reports whether the lines a and b are identical, but the value of their first field.
+func sameLine(a, b []byte) bool {
+	as, ae := timeSpan(a)
+	bs, be := timeSpan(b)
+	return bytes.Equal(a[:as], b[:bs]) && bytes.Equal(a[ae:], b[be:])
+}
+
+// timeSpan returns the start and end offset of the (string) value of the first field of the JSON object in line,
+// such as the timestamp of the lines of ULog; or 0, 0 if there is no such.
+func timeSpan(line []byte) (start, end int) {
+	i := bytes.IndexByte(line, '{')
+	if i < 0 {
+		return 0, 0
+	}
+	i = skipSpace(line, i+1)
+	if i >= len(line) || line[i] != '"' {
+		return 0, 0
+	}
+	// The key, with its escapes.
+	for i++; i < len(line) && line[i] != '"'; i++ {
+		if line[i] == '\\' {
+			i++
+		}
+	}
+	if i = skipSpace(line, i+1); i >= len(line) || line[i] != ':' {
+		return 0, 0
+	}
+	if i = skipSpace(line, i+1); i >= len(line) || line[i] != '"' {
+		return 0, 0
+	}
+	j := bytes.IndexByte(line[i+1:], '"')
+	if j < 0 {
+		return 0, 0
+	}
+	return i, i + 1 + j + 1
+}
+
+// skipSpace returns the index of the first non-space byte of line from i.
+func skipSpace(line []byte, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,80 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDedupWriter(t *testing.T) {
+	var buf bytes.Buffer
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	dw := NewDedupWriter(&buf, time.Second).(*dedupWriter)
+	dw.now = func() time.Time { return now }
+
+	for _, line := range []string{"a", "a", "a", "b", "a"} {
+		dw.Write([]byte(line + "\n"))
+	}
+	// The window expires for the run of "c"s.
+	dw.Write([]byte("c\n"))
+	now = now.Add(500 * time.Millisecond)
+	dw.Write([]byte("c\n"))
+	now = now.Add(600 * time.Millisecond)
+	dw.Write([]byte("c\n"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"a", "repeated 2", "b", "a", "c", "repeated 1", "c"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %q, wanted %q", lines, want)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(w, "repeated") {
+			if lines[i] != w {
+				t.Errorf("%d. got %q, wanted %q", i, lines[i], w)
+			}
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &m); err != nil {
+			t.Fatalf("%d. %q: %+v", i, lines[i], err)
+		}
+		if m[DefaultMessageKey] != w || m[RepeatedKey] != float64(w[len(w)-1]-'0') {
+			t.Errorf("%d. got %v, wanted %q", i, m, w)
+		}
+	}
+}
+
+func TestDedupWriterTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	dw := NewDedupWriter(&buf, time.Minute)
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, logger := range []ULog{WithWriter(dw), WithWriter(dw).WithNDJSON()} {
+		logger = logger.WithClock(func() time.Time { return now })
+		for i := 0; i < 3; i++ {
+			now = now.Add(time.Millisecond)
+			logger.Write("same", "a", 1)
+		}
+		logger.Write("other", "a", 1)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	want := []string{"same", "repeated 2", "other", "same", "repeated 2", "other"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %q, wanted %q", lines, want)
+	}
+	for i, w := range want {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i]), &m); err != nil {
+			t.Fatalf("%d. %q: %+v", i, lines[i], err)
+		}
+		if m[DefaultMessageKey] != w {
+			t.Errorf("%d. got %v, wanted %q", i, m, w)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import "io"
+
+// ECSVersion is the version of the Elastic Common Schema written by NewECS.
+const ECSVersion = "1.6.0"
+
+// NewECS returns a ULog writing to w with the Elastic Common Schema field names:
+// @timestamp, message, log.level (see WithLevel) and ecs.version;
+// and the error values written as key.message and key.stack_trace (for WrapError'd errors),
+// so "error" gives error.message and error.stack_trace.
+func NewECS(w io.Writer) ULog {
+	u := WithWriter(w).WithKeyNames("@timestamp", "message").WithLevelKey("log.level")
+	u.opts.splitErrors = true
+	return u.With("ecs.version", ECSVersion)
+}
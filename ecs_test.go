@@ -0,0 +1,41 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewECS(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.NewECS(&buffer)
+
+	logger.WithLevel(ulog.Error).Write("failed", "error", func() error {
+		return func() error { return func() error { return ulog.WrapError(errors.New("boom")) }() }()
+	}())
+	logLine := parseLogLine(buffer.Bytes())
+	require.Contains(t, logLine, "@timestamp")
+	require.Equal(t, "failed", logLine["message"])
+	require.Equal(t, "error", logLine["log.level"])
+	require.Equal(t, ulog.ECSVersion, logLine["ecs.version"])
+	require.Equal(t, "boom", logLine["error.message"])
+	require.True(t, strings.HasPrefix(logLine["error.stack_trace"].(string), "boom\n- "), logLine["error.stack_trace"])
+	require.Contains(t, logLine["error.stack_trace"], "ecs_test.go")
+	for _, k := range []string{"ts", "msg", "level", "error"} {
+		require.NotContains(t, logLine, k)
+	}
+
+	buffer.Reset()
+	logger.Write("plain error", "error", errors.New("simple"))
+	logLine = parseLogLine(buffer.Bytes())
+	require.Equal(t, "simple", logLine["error.message"])
+	require.NotContains(t, logLine, "error.stack_trace")
+}
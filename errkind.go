@@ -0,0 +1,76 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+type errorKind struct {
+	target error
+	kind   string
+}
+
+var (
+	errorKindsMu sync.RWMutex
+	errorKinds   = []errorKind{
+		{context.Canceled, "canceled"},
+		{context.DeadlineExceeded, "deadline_exceeded"},
+		{io.EOF, "eof"},
+		{io.ErrUnexpectedEOF, "unexpected_eof"},
+		{os.ErrNotExist, "not_exist"},
+		{os.ErrPermission, "permission"},
+	}
+)
+
+// RegisterErrorKind registers kind as the classification of the errors matching target (as by errors.Is), for Err.
+//
+// The later registrations take precedence. It panics if target is nil.
+func RegisterErrorKind(target error, kind string) {
+	if target == nil {
+		panic("ulog: RegisterErrorKind with nil target")
+	}
+	errorKindsMu.Lock()
+	errorKinds = append([]errorKind{{target: target, kind: kind}}, errorKinds...)
+	errorKindsMu.Unlock()
+}
+
+// ErrorKind returns the registered classification of err, or "" if none matches.
+func ErrorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	errorKindsMu.RLock()
+	defer errorKindsMu.RUnlock()
+	for _, ek := range errorKinds {
+		if errors.Is(err, ek.target) {
+			return ek.kind
+		}
+	}
+	return ""
+}
+
+// classifiedError is the value of Err.
+type classifiedError struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind,omitempty"`
+}
+
+// Err returns a field value for err, encoded as an object with its message and its kind
+// (the classification registered with RegisterErrorKind, if any):
+//
+//	u.Write("read failed", "error", ulog.Err(err))
+//
+// gives {"error": {"message": "context canceled", "kind": "canceled"}}.
+func Err(err error) Field {
+	if err == nil {
+		return nil
+	}
+	return classifiedError{Message: err.Error(), Kind: ErrorKind(err)}
+}
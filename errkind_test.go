@@ -0,0 +1,62 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+var errQuota = errors.New("quota exceeded")
+
+func TestErr(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	logger.Write("canceled", "error", ulog.Err(fmt.Errorf("query: %w", ctx.Err())))
+	require.Equal(t,
+		map[string]interface{}{"message": "query: context canceled", "kind": "canceled"},
+		parseLogLine(buffer.Bytes())["error"])
+
+	buffer.Reset()
+	logger.Write("unclassified", "error", ulog.Err(errQuota))
+	require.Equal(t, map[string]interface{}{"message": "quota exceeded"}, parseLogLine(buffer.Bytes())["error"])
+
+	ulog.RegisterErrorKind(errQuota, "quota")
+	buffer.Reset()
+	logger.Write("registered", "error", ulog.Err(fmt.Errorf("wrapped: %w", errQuota)))
+	require.Equal(t, "quota", parseLogLine(buffer.Bytes())["error"].(map[string]interface{})["kind"])
+
+	buffer.Reset()
+	logger.Write("nil", "error", ulog.Err(nil))
+	logLine := parseLogLine(buffer.Bytes())
+	require.Contains(t, logLine, "error")
+	require.Nil(t, logLine["error"])
+}
+
+// multiError wraps several errors, as errors.Join.
+type multiError []error
+
+func (me multiError) Error() string   { return fmt.Sprint([]error(me)) }
+func (me multiError) Unwrap() []error { return me }
+
+func TestErrorKindJoined(t *testing.T) {
+	err := multiError{errors.New("first"), fmt.Errorf("second: %w", context.DeadlineExceeded)}
+	require.Equal(t, "deadline_exceeded", ulog.ErrorKind(err))
+	require.Equal(t, "", ulog.ErrorKind(multiError{errors.New("other")}))
+}
+
+func TestRegisterErrorKindNil(t *testing.T) {
+	require.Panics(t, func() { ulog.RegisterErrorKind(nil, "nil") })
+	require.Equal(t, "", ulog.ErrorKind(errors.New("any")))
+}
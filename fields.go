@@ -7,12 +7,22 @@ package ulog
 
 import (
 	"bytes"
+	"context"
+	"database/sql"
 	stdjson "encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"reflect"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 
 	json "github.com/goccy/go-json"
 )
@@ -36,13 +46,56 @@ func (f encodedField) Value() string {
 // encodedFields is a list of encoded fields
 type encodedFields []encodedField
 
+// encOptions configures the encoding of the fields.
+type encOptions struct {
+	noHTMLEscape bool
+	errorCauses  bool
+	noDedup      bool
+	maxKeyLen    int
+	timeFormat   string
+	zeroTimeNull bool
+	boolAsString bool
+	keySanitizer func(string) string
+	// splitErrors writes the error values as key.message and key.stack_trace (ECS).
+	splitErrors bool
+	// unredactedURLs writes the passwords in the URLs.
+	unredactedURLs bool
+	// typeAnnotations writes the Go type of each value next to it.
+	typeAnnotations bool
+	// typeEncoders is copied on write, as it is shared between the loggers.
+	typeEncoders map[reflect.Type]func(interface{}) string
+}
+
+// EncodeField returns the JSON-encoded key and value, just as a ULog with the default options would write them.
+func EncodeField(key string, value interface{}) (string, string) {
+	var eF encodedFields
+	eF.AppendFields([]Field{key, value}, encOptions{})
+	return eF[0].Key(), eF[0].Value()
+}
+
 // Add and encode fields.
-func (eF *encodedFields) AppendFields(fields []Field) *encodedFields {
+func (eF *encodedFields) AppendFields(fields []Field, opts encOptions) *encodedFields {
 	if eF == nil {
 		return eF
 	}
-	eF.Grow(len(fields) / 2)
 	js := scratchJS.Get().(*jsonEncoder)
+	js.SetOptions(opts)
+	eF.appendFields(fields, js)
+	scratchJS.Put(js)
+	return eF
+}
+
+// appendFields encodes the fields with js.
+func (eF *encodedFields) appendFields(fields []Field, js *jsonEncoder) *encodedFields {
+	return eF.appendFieldsIndexed(fields, js, nil)
+}
+
+// appendFieldsIndexed is appendFields, with base as the index of the keys already in eF (see indexFields).
+func (eF *encodedFields) appendFieldsIndexed(fields []Field, js *jsonEncoder, base map[string]int) *encodedFields {
+	opts := js.opts
+	fields = expandConditional(fields)
+	eF.Grow(len(fields) / 2)
+	idx := fieldIndex{eF: eF, base: base, baseLen: len(*eF)}
 	for ix := 0; ix < len(fields); ix += 2 {
 		rawKey := fields[ix]
 		rawValue := fields[ix+1]
@@ -52,17 +105,353 @@ func (eF *encodedFields) AppendFields(fields []Field) *encodedFields {
 			continue
 		}
 
-		key := js.JSON(keyString)
+		if opts.keySanitizer != nil {
+			keyString = opts.keySanitizer(keyString)
+		}
+		if opts.maxKeyLen > 0 && len(keyString) > opts.maxKeyLen {
+			keyString = truncateKey(keyString, opts.maxKeyLen)
+		}
+		if opts.splitErrors {
+			if err, ok := rawValue.(error); ok && err != nil {
+				eF.appendSplitError(&idx, js, keyString, err)
+				continue
+			}
+		}
+		key := js.encode(keyString)
 		value := js.JSON(rawValue)
+		if opts.noDedup {
+			*eF = append(*eF, encodedField{key, value})
+		} else {
+			idx.set(key, value)
+		}
+
+		if opts.errorCauses {
+			if err, ok := rawValue.(error); ok && err != nil {
+				idx.set(js.encode(keyString+CausesSuffix), js.encode(errorCauses(err)))
+			}
+		}
+		if opts.typeAnnotations {
+			idx.set(js.encode(keyString+TypeSuffix), js.encode(typeName(rawValue)))
+		}
+	}
+	idx.release()
+	return eF
+}
 
-		if i := eF.Index(key); i >= 0 {
-			(*eF)[i][1] = value
+// typeName returns the Go type of v, as with %T.
+func typeName(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// appendSplitError appends err as keyString.message, and keyString.stack_trace if it is wrapped.
+func (eF *encodedFields) appendSplitError(idx *fieldIndex, js *jsonEncoder, keyString string, err error) {
+	set := func(k, v string) {
+		key, value := js.encode(k), js.encode(v)
+		if js.opts.noDedup {
+			*eF = append(*eF, encodedField{key, value})
+		} else {
+			idx.set(key, value)
+		}
+	}
+	set(keyString+".message", err.Error())
+	walkErrors(err, func(err error) bool {
+		if we, ok := err.(*wrappedErr); ok {
+			set(keyString+".stack_trace", we.Details)
+			return false
+		}
+		return true
+	})
+}
+
+// conditionalFields is a sentinel in the key position, which stands for its fields iff cond.
+type conditionalFields struct {
+	fields []Field
+	cond   bool
+}
+
+// When returns a field pair to be used in the place of a key and value,
+// which is dropped if cond is false:
+//
+//	logger.Write("m", ulog.When(verbose, "detail", d))
+func When(cond bool, key string, value interface{}) Field {
+	return WhenAll(cond, key, value)
+}
+
+// WhenAll is like When, but with any number of alternating keys and values.
+func WhenAll(cond bool, keyvals ...Field) Field {
+	return conditionalFields{cond: cond, fields: keyvals}
+}
+
+// expandConditional replaces the conditionalFields in fields with their fields, or drops them.
+func expandConditional(fields []Field) []Field {
+	first := -1
+	for ix := 0; ix < len(fields); ix += 2 {
+		if _, ok := fields[ix].(conditionalFields); ok {
+			first = ix
+			break
+		}
+	}
+	if first < 0 {
+		return fields
+	}
+	ff := append(make([]Field, 0, len(fields)+2), fields[:first]...)
+	for ix := first; ix < len(fields); {
+		cf, ok := fields[ix].(conditionalFields)
+		if !ok {
+			if ix+1 < len(fields) {
+				ff = append(ff, fields[ix], fields[ix+1])
+			}
+			ix += 2
 			continue
 		}
+		if cf.cond {
+			cff := expandConditional(cf.fields)
+			ff = append(ff, cff[:len(cff)&^1]...)
+		}
+		ix++
+	}
+	return ff
+}
+
+// MergeFields returns the alternating keys and values of base and extra, deduplicated by key
+// as the loggers do: the last value wins, but in the place of the first occurrence.
+func MergeFields(base []Field, extra ...Field) []Field {
+	all := expandConditional(append(base[:len(base):len(base)], extra...))
+	merged := make([]Field, 0, len(all)&^1)
+	index := make(map[string]int, len(all)/2)
+	for ix := 0; ix+1 < len(all); ix += 2 {
+		if k, ok := all[ix].(string); ok {
+			if i, ok := index[k]; ok {
+				merged[i+1] = all[ix+1]
+				continue
+			}
+			index[k] = len(merged)
+		}
+		merged = append(merged, all[ix], all[ix+1])
+	}
+	return merged
+}
+
+// TruncatedKeyMarker is appended to the keys truncated by ULog.WithMaxKeyLen.
+const TruncatedKeyMarker = "…"
 
-		*eF = append(*eF, encodedField{key, value})
+// truncateKey cuts key to at most n bytes (on a rune boundary), and appends TruncatedKeyMarker.
+func truncateKey(key string, n int) string {
+	for n > 0 && !utf8.RuneStart(key[n]) {
+		n--
 	}
+	return key[:n] + TruncatedKeyMarker
+}
+
+// detach returns a copy of eF with its keys and values copied out of the arena (see borrowArena),
+// for anything which may keep them after the line is written.
+func (eF encodedFields) detach() encodedFields {
+	var n int
+	for _, f := range eF {
+		n += len(f.Key()) + len(f.Value())
+	}
+	// A single allocation for all the strings.
+	var sb strings.Builder
+	sb.Grow(n)
+	for _, f := range eF {
+		sb.WriteString(f.Key())
+		sb.WriteString(f.Value())
+	}
+	all := sb.String()
+	dF := make(encodedFields, len(eF))
+	for i, f := range eF {
+		k, v := len(f.Key()), len(f.Value())
+		dF[i] = encodedField{all[:k], all[k : k+v]}
+		all = all[k+v:]
+	}
+	return dF
+}
+
+// encodeKey returns the encoded form of key, as used in encodedFields.
+func encodeKey(key string) string {
+	js := scratchJS.Get().(*jsonEncoder)
+	js.SetOptions(encOptions{})
+	k := js.encode(key)
 	scratchJS.Put(js)
+	return k
+}
+
+// reorder moves the fields with the given keys to the front, in the order of keys,
+// keeping the order of the rest.
+//
+// The keys are encoded with js, just as the keys of the fields.
+func (eF encodedFields) reorder(keys []string, js *jsonEncoder) {
+	pos := 0
+	for _, k := range keys {
+		k = js.encode(k)
+		for i := pos; i < len(eF); i++ {
+			if eF[i].Key() == k {
+				f := eF[i]
+				copy(eF[pos+1:i+1], eF[pos:i])
+				eF[pos] = f
+				pos++
+				break
+			}
+		}
+	}
+}
+
+// indexThreshold is the number of fields above which fieldIndex switches to a map.
+const indexThreshold = 16
+
+// scratchIndexes pools the maps of fieldIndex.
+var scratchIndexes = sync.Pool{New: func() interface{} { return make(map[string]int) }}
+
+// fieldIndex speeds up the key lookups of encodedFields while appending to it:
+// above indexThreshold fields the linear Index scan is replaced by an auxiliary map.
+//
+// The fields must be modified only through the fieldIndex while it's in use.
+//
+// With a base index of the first baseLen fields (see WithDedupMap),
+// only the fields appended after those are scanned linearly.
+type fieldIndex struct {
+	eF      *encodedFields
+	m       map[string]int
+	base    map[string]int
+	baseLen int
+}
+
+// Index returns the index of the encoded key, or -1.
+func (fi *fieldIndex) Index(key string) int {
+	if fi.base != nil {
+		if i, ok := fi.base[key]; ok {
+			return i
+		}
+		for i, f := range (*fi.eF)[fi.baseLen:] {
+			if f.Key() == key {
+				return fi.baseLen + i
+			}
+		}
+		return -1
+	}
+	if fi.m == nil {
+		if len(*fi.eF) <= indexThreshold {
+			return fi.eF.Index(key)
+		}
+		fi.m = scratchIndexes.Get().(map[string]int)
+		for i, f := range *fi.eF {
+			fi.m[f.Key()] = i
+		}
+	}
+	if i, ok := fi.m[key]; ok {
+		return i
+	}
+	return -1
+}
+
+// release the map of fi to the pool, emptied. fi must not be used after that.
+func (fi *fieldIndex) release() {
+	if fi.m == nil {
+		return
+	}
+	// The map does not shrink, so do not keep an exceptionally large one around.
+	if len(fi.m) <= maxPooledFields {
+		for k := range fi.m {
+			delete(fi.m, k)
+		}
+		scratchIndexes.Put(fi.m)
+	}
+	fi.m = nil
+}
+
+// set the value of the encoded key, appending it if it's not already set.
+func (fi *fieldIndex) set(key, value string) {
+	if i := fi.Index(key); i >= 0 {
+		(*fi.eF)[i][1] = value
+		return
+	}
+	if fi.m != nil {
+		fi.m[key] = len(*fi.eF)
+	}
+	*fi.eF = append(*fi.eF, encodedField{key, value})
+}
+
+// dropOldest returns the last n fields of eF, and the DroppedFieldsKey field,
+// with the number of fields dropped (now and before).
+//
+// The field with the (encoded) keep key is kept besides those, as the first one.
+func (eF encodedFields) dropOldest(n int, keep string) encodedFields {
+	key := encodeKey(DroppedFieldsKey)
+	var dropped int
+	if i := eF.Index(key); i >= 0 {
+		dropped, _ = strconv.Atoi(eF[i].Value())
+		eF = append(append(make(encodedFields, 0, len(eF)), eF[:i]...), eF[i+1:]...)
+	}
+	dF := make(encodedFields, 0, n+2)
+	if i := eF.Index(keep); keep != "" && i >= 0 {
+		dF = append(dF, eF[i])
+		eF = append(append(make(encodedFields, 0, len(eF)), eF[:i]...), eF[i+1:]...)
+	}
+	if len(eF) > n {
+		dropped += len(eF) - n
+		eF = eF[len(eF)-n:]
+	}
+	return append(append(dF, eF...), encodedField{key, strconv.Itoa(dropped)})
+}
+
+// indexFields returns the map of the keys of eF to their indexes.
+func indexFields(eF encodedFields) map[string]int {
+	m := make(map[string]int, len(eF))
+	for i, f := range eF {
+		m[f.Key()] = i
+	}
+	return m
+}
+
+// CausesSuffix is appended to the key of an error field to get the key of its cause chain,
+// see ULog.WithErrorCauses.
+const CausesSuffix = "_causes"
+
+// TypeSuffix is appended to the key of a field to get the key of the Go type of its value,
+// see ULog.WithTypeAnnotations.
+const TypeSuffix = "_type"
+
+// maxCauses bounds the length of the cause chain, to be safe from cycles.
+const maxCauses = 32
+
+// walkErrors calls f with err and its wrapped errors, outermost first, until f returns false.
+//
+// Safe from cyclic Unwrap chains: it stops at an already seen pointer, and after maxCauses errors.
+func walkErrors(err error, f func(error) bool) {
+	var seen [maxCauses]uintptr
+	for n := 0; err != nil && n < maxCauses; n, err = n+1, errors.Unwrap(err) {
+		// Only pointers can form a cycle - and comparing them never panics, unlike interfaces.
+		if rv := reflect.ValueOf(err); rv.Kind() == reflect.Ptr {
+			p := rv.Pointer()
+			for _, s := range seen[:n] {
+				if s == p {
+					return
+				}
+			}
+			seen[n] = p
+		}
+		if !f(err) {
+			return
+		}
+	}
+}
+
+// errorCauses returns the Error() strings of err and its wrapped errors, outermost first.
+func errorCauses(err error) []string {
+	var causes []string
+	walkErrors(err, func(err error) bool {
+		causes = append(causes, err.Error())
+		return true
+	})
+	return causes
+}
+
+// appendRaw appends the fields as is, without checking for duplicates.
+func (eF *encodedFields) appendRaw(fields encodedFields) *encodedFields {
+	*eF = append(*eF, fields...)
 	return eF
 }
 
@@ -72,13 +461,11 @@ func (eF *encodedFields) AppendEncoded(fields encodedFields) *encodedFields {
 		return eF
 	}
 	eF.Grow(len(fields))
+	idx := fieldIndex{eF: eF}
 	for _, f := range fields {
-		if i := eF.Index(f.Key()); i >= 0 {
-			(*eF)[i][1] = f.Value()
-		} else {
-			*eF = append(*eF, f)
-		}
+		idx.set(f.Key(), f.Value())
 	}
+	idx.release()
 	return eF
 }
 
@@ -106,14 +493,52 @@ func (eF *encodedFields) Grow(length int) *encodedFields {
 func (eF *encodedFields) Reset() *encodedFields { *eF = (*eF)[:0]; return eF }
 
 type jsonEncoder struct {
-	buf    *strings.Builder
+	buf    *bytes.Buffer
 	enc    *json.Encoder
 	stdEnc *stdjson.Encoder
+	opts   encOptions
+
+	// arena holds the results of encode, while borrowed by a single write - see borrowArena.
+	arena    []byte
+	useArena bool
+}
+
+// maxArenaSize is the capacity above which the arena is not kept in the pool.
+const maxArenaSize = 64 << 10
+
+// borrowArena makes the subsequent encode calls return strings pointing into the arena,
+// saving an allocation per key and value.
+//
+// Those strings are valid only till releaseArena, and must not be retained after that:
+// only copy them into the line, and hand over detached copies (see encodedFields.detach) to anything else.
+func (js *jsonEncoder) borrowArena() {
+	js.arena, js.useArena = js.arena[:0], true
+}
+
+// releaseArena ends the borrowArena period.
+func (js *jsonEncoder) releaseArena() {
+	js.useArena = false
+	if cap(js.arena) > maxArenaSize {
+		js.arena = nil
+	}
+}
+
+// SetOptions sets the options for the subsequent JSON calls.
+//
+// As the jsonEncoders are pooled, this must be called after each Get.
+func (js *jsonEncoder) SetOptions(opts encOptions) {
+	if opts.noHTMLEscape != js.opts.noHTMLEscape {
+		js.enc.SetEscapeHTML(!opts.noHTMLEscape)
+		if js.stdEnc != nil {
+			js.stdEnc.SetEscapeHTML(!opts.noHTMLEscape)
+		}
+	}
+	js.opts = opts
 }
 
 var scratchJS = sync.Pool{
 	New: func() interface{} {
-		js := jsonEncoder{buf: &strings.Builder{}}
+		js := jsonEncoder{buf: &bytes.Buffer{}}
 		js.enc = json.NewEncoder(js.buf)
 		return &js
 	},
@@ -124,13 +549,23 @@ type wrappedErr struct {
 	Err, Details string
 }
 
+// formatFrame returns the file:line:function form of the frame, as written in the stack traces.
+func formatFrame(frame runtime.Frame) string {
+	return trimPath(frame.File) + ":" + strconv.Itoa(frame.Line) + ":" + frame.Function
+}
+
 func WrapError(err error) error {
+	return wrapError(err, 6)
+}
+
+// wrapError wraps err with the stack trace, skipping skip frames (see runtime.Callers).
+func wrapError(err error, skip int) error {
 	if err == nil {
 		return nil
 	}
 
 	var pc [16]uintptr
-	n := runtime.Callers(5, pc[:])
+	n := runtime.Callers(skip, pc[:])
 	var frames *runtime.Frames
 	if n != 0 {
 		frames = runtime.CallersFrames(pc[:n])
@@ -146,7 +581,8 @@ func WrapError(err error) error {
 	// A fixed number of pcs can expand to an indefinite number of Frames.
 	for {
 		frame, more := frames.Next()
-		fmt.Fprintf(sb, "\n- %s:%d:%s", frame.File, frame.Line, frame.Function)
+		sb.WriteString("\n- ")
+		sb.WriteString(formatFrame(frame))
 		if !more {
 			break
 		}
@@ -156,6 +592,32 @@ func WrapError(err error) error {
 	return &we
 }
 
+var trimPrefix atomic.Value
+
+// SetTrimPrefix sets the prefix to be trimmed from the file paths emitted (by WrapError, for example),
+// such as the module root, to have machine-independent paths.
+//
+// The prefix is trimmed only at a path component boundary, with or without a trailing slash.
+// The empty prefix means no trimming.
+func SetTrimPrefix(prefix string) { trimPrefix.Store(prefix) }
+
+// trimPath trims the prefix set by SetTrimPrefix from file,
+// only at a path component boundary.
+func trimPath(file string) string {
+	prefix, _ := trimPrefix.Load().(string)
+	if prefix == "" || !strings.HasPrefix(file, prefix) {
+		return file
+	}
+	rest := file[len(prefix):]
+	if strings.HasSuffix(prefix, "/") {
+		return rest
+	}
+	if strings.HasPrefix(rest, "/") {
+		return rest[1:]
+	}
+	return file
+}
+
 // StackTrace returns stack trace of an error.
 func (we *wrappedErr) Error() string { return we.Err }
 func (we *wrappedErr) Unwrap() error { return we.err }
@@ -169,24 +631,176 @@ func (we *wrappedErr) Format(f fmt.State, c rune) {
 	}
 }
 
+// JSON returns the JSON encoding of the field value v, converted according to the options.
 func (js *jsonEncoder) JSON(v interface{}) string {
+	return js.encode(js.convert(v))
+}
+
+// convertMessage converts special messages (such as proto.Message, with the "protobuf" build tag)
+// to the value to be encoded, if not nil.
+var convertMessage func(interface{}) (interface{}, bool)
+
+// convert the field value v to the value to be encoded.
+func (js *jsonEncoder) convert(v interface{}) interface{} {
+	if len(js.opts.typeEncoders) != 0 && v != nil {
+		if fn, ok := js.opts.typeEncoders[reflect.TypeOf(v)]; ok {
+			return fn(v)
+		}
+	}
+	if c, ok := convertSQLNull(v); ok {
+		v = c
+	}
+	if convertMessage != nil {
+		if c, ok := convertMessage(v); ok {
+			v = c
+		}
+	}
+	switch x := v.(type) {
+	case *url.URL:
+		if x != nil {
+			if js.opts.unredactedURLs {
+				return x.String()
+			}
+			return x.Redacted()
+		}
+	case url.URL:
+		if js.opts.unredactedURLs {
+			return x.String()
+		}
+		return x.Redacted()
+	case net.Addr:
+		if rv := reflect.ValueOf(x); rv.Kind() != reflect.Ptr || !rv.IsNil() {
+			return x.String()
+		}
+	}
+	if ctx, ok := v.(context.Context); ok && ctx != nil {
+		return describeContext(ctx)
+	}
+	if r, ok := v.(Ranger); ok {
+		if rv := reflect.ValueOf(r); rv.Kind() != reflect.Ptr || !rv.IsNil() {
+			return js.rangeMap(r)
+		}
+	}
+	if js.opts.boolAsString {
+		if b, ok := v.(bool); ok {
+			return strconv.FormatBool(b)
+		}
+	}
+	if js.opts.zeroTimeNull {
+		if t, ok := v.(time.Time); ok && t.IsZero() {
+			return nil
+		}
+	}
+	if js.opts.timeFormat != "" {
+		if t, ok := v.(time.Time); ok {
+			return t.Format(js.opts.timeFormat)
+		}
+	}
 	if err, ok := v.(error); ok && err != nil {
 		var we *wrappedErr
-		if errors.As(err, &we) {
-			v = we.Details
-		} else {
-			v = fmt.Sprintf("%+v", err)
+		walkErrors(err, func(err error) bool {
+			we, _ = err.(*wrappedErr)
+			return we == nil
+		})
+		if we != nil {
+			return we.Details
 		}
+		return fmt.Sprintf("%+v", err)
 	}
+	return v
+}
+
+// contextDescriptor is logged instead of a context.Context, which would be encoded as an empty object.
+type contextDescriptor struct {
+	Err      *string    `json:"err"`
+	Deadline *time.Time `json:"deadline"`
+}
+
+func describeContext(ctx context.Context) contextDescriptor {
+	var d contextDescriptor
+	if err := ctx.Err(); err != nil {
+		s := err.Error()
+		d.Err = &s
+	}
+	if t, ok := ctx.Deadline(); ok {
+		d.Deadline = &t
+	}
+	return d
+}
+
+// Ranger is a container with a sync.Map-like Range method, such as *sync.Map.
+// As it has no exported fields, its entries are encoded as a JSON object, with the keys formatted by fmt.Sprint.
+type Ranger interface {
+	Range(f func(key, value interface{}) bool)
+}
+
+// rangeMap returns the entries of r as a map.
+func (js *jsonEncoder) rangeMap(r Ranger) map[string]interface{} {
+	m := make(map[string]interface{})
+	r.Range(func(key, value interface{}) bool {
+		k, ok := key.(string)
+		if !ok {
+			k = fmt.Sprint(key)
+		}
+		m[k] = js.convert(value)
+		return true
+	})
+	return m
+}
+
+// convertSQLNull returns the inner value of a database/sql Null* type, or nil if it is not Valid.
+func convertSQLNull(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case sql.NullString:
+		if x.Valid {
+			return x.String, true
+		}
+	case sql.NullInt64:
+		if x.Valid {
+			return x.Int64, true
+		}
+	case sql.NullInt32:
+		if x.Valid {
+			return x.Int32, true
+		}
+	case sql.NullFloat64:
+		if x.Valid {
+			return x.Float64, true
+		}
+	case sql.NullBool:
+		if x.Valid {
+			return x.Bool, true
+		}
+	case sql.NullTime:
+		if x.Valid {
+			return x.Time, true
+		}
+	default:
+		return v, false
+	}
+	return nil, true
+}
+
+// encode v as JSON, as is.
+func (js *jsonEncoder) encode(v interface{}) string {
 	js.buf.Reset()
 	if err := js.enc.Encode(v); err != nil {
 		if js.stdEnc == nil {
 			js.stdEnc = stdjson.NewEncoder(js.buf)
+			js.stdEnc.SetEscapeHTML(!js.opts.noHTMLEscape)
 		}
 		if err = js.stdEnc.Encode(v); err != nil {
 			js.buf.Reset()
 			js.enc.Encode(err.Error())
 		}
 	}
-	return strings.TrimSpace(js.buf.String())
+	b := bytes.TrimSpace(js.buf.Bytes())
+	if !js.useArena {
+		return string(b)
+	}
+	// Appending may reallocate the arena, but the previous strings keep the old array alive.
+	start := len(js.arena)
+	js.arena = append(js.arena, b...)
+	b = js.arena[start:len(js.arena):len(js.arena)]
+	return *(*string)(unsafe.Pointer(&b))
 }
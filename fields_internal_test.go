@@ -0,0 +1,43 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import "testing"
+
+func TestTrimPath(t *testing.T) {
+	defer SetTrimPrefix("")
+	for _, tc := range []struct {
+		prefix, file, want string
+	}{
+		{"", "/src/a/x.go", "/src/a/x.go"},
+		{"/src/a", "/src/a/x.go", "x.go"},
+		{"/src/a/", "/src/a/x.go", "x.go"},
+		{"/src/a", "/src/ab/x.go", "/src/ab/x.go"},
+		{"/src/a", "/other/x.go", "/other/x.go"},
+	} {
+		SetTrimPrefix(tc.prefix)
+		if got := trimPath(tc.file); got != tc.want {
+			t.Errorf("%q/%q: got %q, wanted %q", tc.prefix, tc.file, got, tc.want)
+		}
+	}
+}
+
+func TestDetachArena(t *testing.T) {
+	js := scratchJS.Get().(*jsonEncoder)
+	defer scratchJS.Put(js)
+	js.SetOptions(encOptions{})
+	js.borrowArena()
+	dF := encodedFields{{js.encode("user"), js.encode("alice")}}.detach()
+	js.releaseArena()
+
+	// The next write reuses the arena.
+	js.borrowArena()
+	js.encode("XXXXXX")
+	js.encode("XXXXXXXXXXXX")
+	js.releaseArena()
+	if k, v := dF[0].Key(), dF[0].Value(); k != `"user"` || v != `"alice"` {
+		t.Errorf("got %s: %s, wanted \"user\": \"alice\"", k, v)
+	}
+}
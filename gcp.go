@@ -0,0 +1,79 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"context"
+	"io"
+	"strings"
+)
+
+const (
+	// GCPSeverityKey is the key of the level, in Google Cloud Logging.
+	GCPSeverityKey = "severity"
+	// GCPTraceKey is the key of the trace, in Google Cloud Logging.
+	GCPTraceKey = "logging.googleapis.com/trace"
+)
+
+var gcpSeverities = [...]string{Debug: "DEBUG", Info: "INFO", Warn: "WARNING", Error: "ERROR"}
+
+// GCPSeverity returns the Google Cloud Logging severity of l, or "" for an unknown level.
+func GCPSeverity(l Level) string {
+	if int(l) < len(gcpSeverities) {
+		return gcpSeverities[l]
+	}
+	return ""
+}
+
+// parseGCPSeverity returns the Level for a GCP severity, or 0 if it is unknown.
+// The severities above ERROR (such as CRITICAL) are Error.
+func parseGCPSeverity(s string) Level {
+	for i, nm := range gcpSeverities {
+		if nm != "" && nm == s {
+			return Level(i)
+		}
+	}
+	switch s {
+	case "CRITICAL", "ALERT", "EMERGENCY":
+		return Error
+	}
+	return 0
+}
+
+// NewGCP returns a ULog writing to w in the structured format of Google Cloud Logging:
+// time, message, and severity (see WithLevel) with the GCP severity names (such as WARNING).
+func NewGCP(w io.Writer) ULog {
+	u := WithWriter(w).WithKeyNames("time", "message").WithLevelKey(GCPSeverityKey)
+	u.levelName = GCPSeverity
+	return u
+}
+
+type gcpTraceCtxKey struct{}
+
+// ContextWithGCPTrace returns a Context carrying the trace id, for WithGCPTrace.
+//
+// The trace id of an incoming request is the part before the "/" of its X-Cloud-Trace-Context header,
+// see GCPTraceID.
+func ContextWithGCPTrace(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, gcpTraceCtxKey{}, traceID)
+}
+
+// GCPTraceID returns the trace id of an X-Cloud-Trace-Context header value (TRACE_ID/SPAN_ID;o=1).
+func GCPTraceID(header string) string {
+	if i := strings.IndexAny(header, "/;"); i >= 0 {
+		header = header[:i]
+	}
+	return header
+}
+
+// WithGCPTrace returns a copy of the ULog instance with the trace of ctx (see ContextWithGCPTrace)
+// under GCPTraceKey, as projects/projectID/traces/TRACE_ID, for linking the logs with the traces.
+func (u ULog) WithGCPTrace(ctx context.Context, projectID string) ULog {
+	traceID, _ := ctx.Value(gcpTraceCtxKey{}).(string)
+	if traceID == "" {
+		return u
+	}
+	return u.With(GCPTraceKey, "projects/"+projectID+"/traces/"+traceID)
+}
@@ -0,0 +1,45 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewGCP(t *testing.T) {
+	var buffer, errs bytes.Buffer
+	logger := ulog.NewGCP(&buffer).WithErrorSink(&errs)
+
+	for l, want := range map[ulog.Level]string{
+		ulog.Debug: "DEBUG", ulog.Info: "INFO", ulog.Warn: "WARNING", ulog.Error: "ERROR",
+	} {
+		buffer.Reset()
+		logger.WithLevel(l).Write("severity")
+		logLine := parseLogLine(buffer.Bytes())
+		require.Equal(t, want, logLine[ulog.GCPSeverityKey])
+		require.Equal(t, "severity", logLine["message"])
+		require.Contains(t, logLine, "time")
+		require.NotContains(t, logLine, ulog.DefaultMessageKey)
+		require.NotContains(t, logLine, ulog.DefaultTimestampKey)
+	}
+	// The error sink recognizes the GCP severity.
+	require.Equal(t, "ERROR", parseLogLine(errs.Bytes())[ulog.GCPSeverityKey])
+
+	buffer.Reset()
+	traceID := ulog.GCPTraceID("105445aa7843bc8bf206b12000100000/1;o=1")
+	ctx := ulog.ContextWithGCPTrace(context.Background(), traceID)
+	logger.WithGCPTrace(ctx, "my-project").Write("traced")
+	require.Equal(t, "projects/my-project/traces/105445aa7843bc8bf206b12000100000",
+		parseLogLine(buffer.Bytes())[ulog.GCPTraceKey])
+
+	buffer.Reset()
+	logger.WithGCPTrace(context.Background(), "my-project").Write("untraced")
+	require.NotContains(t, parseLogLine(buffer.Bytes()), ulog.GCPTraceKey)
+}
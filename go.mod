@@ -3,6 +3,8 @@ module github.com/UNO-SOFT/ulog
 go 1.15
 
 require (
-	github.com/goccy/go-json v0.7.3 // indirect
+	github.com/fxamacker/cbor/v2 v2.4.0
+	github.com/goccy/go-json v0.7.3
 	github.com/stretchr/testify v1.6.1
+	google.golang.org/protobuf v1.26.0
 )
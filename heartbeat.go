@@ -0,0 +1,40 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"context"
+	"time"
+)
+
+// Heartbeat starts a goroutine which writes msg with the fields every interval, until ctx is cancelled -
+// for liveness monitoring of otherwise quiet services.
+//
+// A non-positive interval starts nothing.
+func (u ULog) Heartbeat(ctx context.Context, interval time.Duration, msg string, fields ...Field) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	done := u.heartbeat(ctx, ticker.C, msg, fields)
+	go func() { <-done; ticker.Stop() }()
+}
+
+// heartbeat writes msg on each tick, until ctx is cancelled; the returned channel is closed after that.
+func (u ULog) heartbeat(ctx context.Context, tick <-chan time.Time, msg string, fields []Field) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+				u.Write(msg, fields...)
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lockedBuffer struct {
+	mu sync.Mutex
+	bytes.Buffer
+}
+
+func (lb *lockedBuffer) Write(p []byte) (int, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return lb.Buffer.Write(p)
+}
+
+func (lb *lockedBuffer) lines() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return strings.Count(lb.String(), "\n")
+}
+
+func TestHeartbeat(t *testing.T) {
+	var buf lockedBuffer
+	var mu sync.Mutex
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := func() time.Time { mu.Lock(); defer mu.Unlock(); return now }
+	// Unbuffered, so each send returns only when the previous beat is written.
+	tick := make(chan time.Time)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := WithWriter(&buf).WithClock(clock).
+		heartbeat(ctx, tick, "alive", []Field{"service", "quiet"})
+
+	for i := 0; i < 3; i++ {
+		mu.Lock()
+		now = now.Add(time.Minute)
+		mu.Unlock()
+		tick <- clock()
+	}
+	cancel()
+	<-done
+	if n := buf.lines(); n != 3 {
+		t.Fatalf("got %d heartbeats, wanted 3:\n%s", n, buf.String())
+	}
+	if !strings.Contains(buf.String(), `"msg": "alive", "service": "quiet"`) {
+		t.Errorf("missing fields: %s", buf.String())
+	}
+
+	select {
+	case tick <- clock():
+		t.Error("heartbeat still running after cancel")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestHeartbeatNonPositive(t *testing.T) {
+	var buf lockedBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, interval := range []time.Duration{0, -time.Second} {
+		WithWriter(&buf).Heartbeat(ctx, interval, "alive")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := buf.lines(); n != 0 {
+		t.Errorf("got %d heartbeats, wanted none:\n%s", n, buf.String())
+	}
+}
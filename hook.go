@@ -0,0 +1,53 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import "time"
+
+// HookEntry is what a hook gets about a written line.
+//
+// Line is valid only during the hook call: copy it to keep it.
+// The rest (such as the keys and values returned by Field) may be kept.
+type HookEntry struct {
+	// Time is the timestamp of the line.
+	Time time.Time
+	// Message is the message of the line, empty if none.
+	Message string
+	// Line is the line as written.
+	Line []byte
+	// Meta is the metadata set with WithMeta, which is not written to the line. Do not modify it!
+	Meta map[string]interface{}
+
+	fields encodedFields
+}
+
+// NumFields returns the number of the fields of the line (besides the timestamp and the message).
+func (e HookEntry) NumFields() int { return len(e.fields) }
+
+// Field returns the JSON-encoded key and value of the i-th field.
+func (e HookEntry) Field(i int) (key, value string) {
+	f := e.fields[i]
+	return f.Key(), f.Value()
+}
+
+// WithHook returns a copy of the ULog instance which calls hook after writing each line,
+// such as for metrics or routing.
+func (u ULog) WithHook(hook func(HookEntry)) ULog {
+	v := u
+	v.hooks = append(u.hooks[:len(u.hooks):len(u.hooks)], hook)
+	return v
+}
+
+// WithMeta returns a copy of the ULog instance with metadata value under key,
+// which is not written to the lines, but is readable by the hooks (see WithHook) in HookEntry.Meta.
+func (u ULog) WithMeta(key string, value interface{}) ULog {
+	v := u
+	v.meta = make(map[string]interface{}, len(u.meta)+1)
+	for k, x := range u.meta {
+		v.meta[k] = x
+	}
+	v.meta[key] = value
+	return v
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMeta(t *testing.T) {
+	var buffer bytes.Buffer
+	var entries []ulog.HookEntry
+	var fields []string
+	logger := ulog.WithWriter(&buffer).WithMeta("metric", "requests").
+		WithHook(func(e ulog.HookEntry) {
+			e.Line = append([]byte(nil), e.Line...)
+			entries = append(entries, e)
+			for i := 0; i < e.NumFields(); i++ {
+				k, v := e.Field(i)
+				fields = append(fields, k+"="+v)
+			}
+		})
+
+	logger.With("a", 1).WithMeta("route", "audit").Write("hooked", "b", "x")
+	require.Len(t, entries, 1)
+	e := entries[0]
+	require.Equal(t, "hooked", e.Message)
+	require.Equal(t, map[string]interface{}{"metric": "requests", "route": "audit"}, e.Meta)
+	require.Equal(t, buffer.String(), string(e.Line))
+	require.Equal(t, []string{`"a"=1`, `"b"="x"`}, fields)
+
+	logLine := parseLogLine(buffer.Bytes())
+	require.Len(t, logLine, 4)
+	require.NotContains(t, buffer.String(), "requests")
+	require.NotContains(t, buffer.String(), "route")
+
+	// The meta of the parent is not modified.
+	buffer.Reset()
+	logger.Write("parent")
+	require.Equal(t, map[string]interface{}{"metric": "requests"}, entries[1].Meta)
+}
+
+func TestHookKeepField(t *testing.T) {
+	var kept []string
+	logger := ulog.WithWriter(&bytes.Buffer{}).WithHook(func(e ulog.HookEntry) {
+		if kept == nil {
+			k, v := e.Field(0)
+			kept = []string{k, v}
+		}
+	})
+	logger.Write("first", "user", "alice")
+	// The next line reuses the buffers of the previous one.
+	logger.Write("second", "XXXXXXXXXX", "XXXXXXXXXXXXXXXXXXXX", "XXXXXX", "XXXXXX")
+	require.Equal(t, []string{`"user"`, `"alice"`}, kept)
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Redacted is the value emitted instead of the sensitive values.
+const Redacted = "REDACTED"
+
+// RedactedHeaders are the headers whose values are replaced by Redacted by RequestFields and ResponseFields.
+var RedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// RequestFields returns the fields describing an outbound request: method, url, content_length
+// and headers (all of them, or only the listed ones), with the RedactedHeaders redacted.
+func RequestFields(req *http.Request, headers ...string) []Field {
+	if req == nil {
+		return nil
+	}
+	u := ""
+	if req.URL != nil {
+		u = req.URL.Redacted()
+	}
+	return []Field{
+		"method", req.Method,
+		"url", u,
+		"content_length", req.ContentLength,
+		"headers", headerMap(req.Header, headers),
+	}
+}
+
+// ResponseFields returns the fields describing a response: status, content_length
+// and headers (all of them, or only the listed ones), with the RedactedHeaders redacted.
+func ResponseFields(resp *http.Response, headers ...string) []Field {
+	if resp == nil {
+		return nil
+	}
+	return []Field{
+		"status", resp.StatusCode,
+		"content_length", resp.ContentLength,
+		"headers", headerMap(resp.Header, headers),
+	}
+}
+
+func headerMap(h http.Header, only []string) map[string]string {
+	m := make(map[string]string, len(h))
+	add := func(k string, vv []string) {
+		if len(vv) == 0 {
+			return
+		}
+		k = http.CanonicalHeaderKey(k)
+		for _, r := range RedactedHeaders {
+			if strings.EqualFold(k, r) {
+				m[k] = Redacted
+				return
+			}
+		}
+		m[k] = strings.Join(vv, ", ")
+	}
+	if len(only) == 0 {
+		for k, vv := range h {
+			add(k, vv)
+		}
+	} else {
+		for _, k := range only {
+			add(k, h.Values(k))
+		}
+	}
+	return m
+}
+
+// Recoverer returns a middleware which recovers the panics of the handler, logs them with u
+// (with the panic value and the stack trace of the panic, under "error"), and responds with 500.
+//
+// http.ErrAbortHandler is re-panicked, as that is the way to abort a response.
+func Recoverer(u ULog) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				err, ok := p.(error)
+				if !ok {
+					err = fmt.Errorf("%v", p)
+				}
+				// Skip runtime.Callers, wrapError, this func and runtime.gopanic.
+				u.Write("panic", "panic", fmt.Sprintf("%v", p), "error", wrapError(err, 4),
+					"method", r.Method, "url", r.URL.Redacted())
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// httpError is the value of HTTPError.
+type httpError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Stack  string `json:"stack,omitempty"`
+}
+
+// HTTPError returns a field value for a failed request, encoded as an object with the status code
+// and the error message - and its stack trace, if err is (or wraps) a WrapError'd error:
+//
+//	u.Write("request failed", "http", ulog.HTTPError(500, err))
+func HTTPError(status int, err error) Field {
+	he := httpError{Status: status}
+	if err != nil {
+		he.Error = err.Error()
+		walkErrors(err, func(err error) bool {
+			if we, ok := err.(*wrappedErr); ok {
+				he.Stack = we.Details
+				return false
+			}
+			return true
+		})
+	}
+	return he
+}
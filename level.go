@@ -0,0 +1,146 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"io"
+)
+
+// Level of a log line.
+//
+// ULog does not filter by level, this is only for keeping the level strings consistent.
+type Level uint8
+
+const (
+	Debug = Level(iota + 1)
+	Info
+	Warn
+	Error
+)
+
+// DefaultLevelKey is the key used by WithLevel.
+const DefaultLevelKey = "level"
+
+var levelNames = [...]string{Debug: "debug", Info: "info", Warn: "warn", Error: "error"}
+
+// String returns the canonical lowercase name of the level.
+func (l Level) String() string {
+	if int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return ""
+}
+
+// ParseLevel returns the Level for its canonical name, or 0 if it is unknown.
+func ParseLevel(s string) Level {
+	for i, nm := range levelNames {
+		if nm != "" && nm == s {
+			return Level(i)
+		}
+	}
+	return 0
+}
+
+// MarshalText makes Level encode as its canonical name.
+func (l Level) MarshalText() ([]byte, error) { return []byte(l.String()), nil }
+
+// WithLevelKey returns a copy of the ULog instance which uses the provided key for WithLevel.
+func (u ULog) WithLevelKey(key string) ULog {
+	v := u
+	if key == "" {
+		key = DefaultLevelKey
+	}
+	v.levelKey = key
+	return v
+}
+
+// WithLevel returns a copy of the ULog instance with the level field preset.
+//
+// An unknown level (such as the zero Level) is ignored, and u is returned unchanged.
+func (u ULog) WithLevel(l Level) ULog {
+	s := u.levelString(l)
+	if s == "" {
+		return u
+	}
+	return u.With(u.getLevelKey(), s)
+}
+
+// lineLevel returns the level of an assembled log line,
+// or 0 if the line has no top-level key field with a known level.
+//
+// A literal `"key": "` can only appear as a top-level key in Write's output,
+// as quotes inside strings are escaped and nested objects have no spaces.
+func lineLevel(p []byte, key string) Level {
+	needle := make([]byte, 0, len(key)+5)
+	needle = append(append(append(needle, '"'), key...), `": "`...)
+	i := bytes.Index(p, needle)
+	if i < 0 {
+		return 0
+	}
+	p = p[i+len(needle):]
+	if i = bytes.IndexByte(p, '"'); i < 0 {
+		return 0
+	}
+	if l := ParseLevel(string(p[:i])); l != 0 {
+		return l
+	}
+	return parseGCPSeverity(string(p[:i]))
+}
+
+// WithDefaultLevel returns a copy of the ULog instance which emits l as the level of
+// the lines without an explicit level (by WithLevel or a field with the level key).
+func (u ULog) WithDefaultLevel(l Level) ULog {
+	v := u
+	v.defaultLevel = l
+	return v
+}
+
+// WithErrorSink returns a copy of the ULog instance which copies the lines with at least Error level
+// to w too (such as an alerting pipe), besides the primary writer.
+func (u ULog) WithErrorSink(w io.Writer) ULog {
+	v := u
+	v.errorSink = w
+	return v
+}
+
+// defaultLevelFields returns fields with the default level prepended,
+// if there is a default level and neither the context fields nor fields have a level
+// (not leaving it to the deduplication, which may be off - see WithNoDedup).
+func (u ULog) defaultLevelFields(fields []Field) []Field {
+	if u.defaultLevel == 0 {
+		return fields
+	}
+	s := u.levelString(u.defaultLevel)
+	if s == "" {
+		return fields
+	}
+	key := u.getLevelKey()
+	if u.fields.Index(encodeKey(key)) >= 0 {
+		return fields
+	}
+	all := expandConditional(fields)
+	for ix := 0; ix < len(all); ix += 2 {
+		if k, ok := all[ix].(string); ok && k == key {
+			return fields
+		}
+	}
+	return append(append(make([]Field, 0, 2+len(fields)), key, s), fields...)
+}
+
+// levelString returns the name of l, as written by u.
+func (u ULog) levelString(l Level) string {
+	if u.levelName != nil {
+		return u.levelName(l)
+	}
+	return l.String()
+}
+
+func (u ULog) getLevelKey() string {
+	if u.levelKey == "" {
+		return DefaultLevelKey
+	}
+	return u.levelKey
+}
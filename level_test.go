@@ -0,0 +1,82 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelString(t *testing.T) {
+	for l, want := range map[ulog.Level]string{
+		ulog.Debug: "debug", ulog.Info: "info", ulog.Warn: "warn", ulog.Error: "error",
+	} {
+		require.Equal(t, want, l.String())
+	}
+}
+
+func TestWithLevel(t *testing.T) {
+	var buffer bytes.Buffer
+	ulog.WithWriter(&buffer).WithLevel(ulog.Warn).Write("this is a test")
+	require.Equal(t, "warn", parseLogLine(buffer.Bytes())[ulog.DefaultLevelKey])
+
+	buffer.Reset()
+	ulog.WithWriter(&buffer).WithLevelKey("severity").WithLevel(ulog.Error).Write("this is a test")
+	logLine := parseLogLine(buffer.Bytes())
+	require.Equal(t, "error", logLine["severity"])
+	require.NotContains(t, logLine, ulog.DefaultLevelKey)
+
+	for _, l := range []ulog.Level{0, ulog.Error + 1} {
+		buffer.Reset()
+		ulog.WithWriter(&buffer).WithLevel(l).Write("this is a test")
+		require.NotContains(t, parseLogLine(buffer.Bytes()), ulog.DefaultLevelKey)
+	}
+
+	buffer.Reset()
+	ulog.WithWriter(&buffer).Write("this is a test", "lvl", ulog.Info)
+	require.Equal(t, "info", parseLogLine(buffer.Bytes())["lvl"])
+}
+
+func TestWithDefaultLevel(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer).WithDefaultLevel(ulog.Info)
+
+	logger.Write("no level")
+	require.Equal(t, "info", parseLogLine(buffer.Bytes())[ulog.DefaultLevelKey])
+
+	buffer.Reset()
+	logger.WithLevel(ulog.Error).Write("context level")
+	require.Equal(t, "error", parseLogLine(buffer.Bytes())[ulog.DefaultLevelKey])
+	require.Equal(t, 1, bytes.Count(buffer.Bytes(), []byte(`"level"`)))
+
+	buffer.Reset()
+	logger.Write("call level", ulog.DefaultLevelKey, ulog.Warn)
+	require.Equal(t, "warn", parseLogLine(buffer.Bytes())[ulog.DefaultLevelKey])
+	require.Equal(t, 1, bytes.Count(buffer.Bytes(), []byte(`"level"`)))
+
+	// Not even without the deduplication.
+	buffer.Reset()
+	logger.WithNoDedup().Write("call level", "other", "level", ulog.DefaultLevelKey, ulog.Warn)
+	require.Equal(t, "warn", parseLogLine(buffer.Bytes())[ulog.DefaultLevelKey])
+	require.Equal(t, 1, bytes.Count(buffer.Bytes(), []byte(`"level":`)), buffer.String())
+}
+
+func TestWithErrorSink(t *testing.T) {
+	var primary, sink bytes.Buffer
+	logger := ulog.WithWriter(&primary).WithErrorSink(&sink)
+
+	logger.WithLevel(ulog.Error).Write("failure")
+	logger.WithLevel(ulog.Info).Write("success")
+	logger.Write("no level")
+
+	require.Contains(t, primary.String(), "failure")
+	require.Contains(t, primary.String(), "success")
+	require.Contains(t, primary.String(), "no level")
+	require.Equal(t, 1, bytes.Count(sink.Bytes(), []byte("\n")))
+	require.Equal(t, "failure", parseLogLine(sink.Bytes())[ulog.DefaultMessageKey])
+}
@@ -8,6 +8,7 @@
 // ulog only logs JSON formatted output. Structured logging is the only good logging.
 //
 // ulog does not have log levels. If you don't want something logged, don't log it.
+// (A level field can be attached with WithLevel, but nothing is filtered by it.)
 //
 // ulog does support setting fields in context.
 // Useful for building a log context over the course of an operation.
@@ -15,11 +16,21 @@ package ulog
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
 	"unsafe"
 
 	json "github.com/goccy/go-json"
@@ -30,12 +41,77 @@ type ULog struct {
 	Writer                   io.Writer
 	TimestampKey, MessageKey string `json:"-"`
 
-	fields encodedFields
+	fields       encodedFields
+	now          func() time.Time
+	throttle     *throttle
+	idSource     io.Reader
+	levelKey     string
+	defaultLevel Level
+	// schemaKey is the encoded key of the schema version, kept as the first field.
+	schemaKey string
+
+	elapsedKey string
+	created    time.Time
+
+	dynamic []dynamicField
+
+	omitEmptyMessage bool
+	linePrefix       string
+	fieldCountKey    string
+	errorSink        io.Writer
+	maxLineBytes     int
+	component        string
+	componentKey     string
+	nanoTimestamp    bool
+	fieldOrder       []string
+	omitEmpty        bool
+	keepEmptyString  bool
+	ndjson           bool
+	format           Format
+	timeEncoder      func([]byte, time.Time) []byte
+	foldMessages     bool
+	loggerID         string
+	hooks            []func(HookEntry)
+	meta             map[string]interface{}
+	unixTimestampKey string
+	levelName        func(Level) string
+	callerDepth      int
+	panicError       bool
+	dedupMap         bool
+	maxContextFields int
+	fieldLess        func(a, b string) bool
+	callerOnError    bool
+	index            *fieldsIndex
+
+	stats *stats
+	opts  encOptions
+}
+
+type stats struct {
+	lines, bytes uint64
+}
+
+type dynamicField struct {
+	key string
+	fn  func() interface{}
 }
 
 // New instance of ULog
 func New() ULog {
-	return ULog{TimestampKey: DefaultTimestampKey, MessageKey: DefaultMessageKey, Writer: DefaultWriter}
+	return ULog{TimestampKey: DefaultTimestampKey, MessageKey: DefaultMessageKey, Writer: DefaultWriter,
+		stats: new(stats)}
+}
+
+// Stats returns the number of lines and bytes written by this logger and all its children.
+//
+// The counters are set up by the constructors (New, WithWriter, NewTestLogger):
+// a ULog literal, such as ULog{Writer: w}, does not count, and always returns 0, 0.
+// The lines to ioutil.Discard are not even formatted, so they are not counted either.
+func (u ULog) Stats() (lines, bytes uint64) {
+	if u.stats == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&u.stats.lines), atomic.LoadUint64(&u.stats.bytes)
 }
 
 // With returns a copy of the ULog instance with the provided fields preset for every subsequent call.
@@ -44,11 +120,168 @@ func (u ULog) With(fields ...Field) ULog {
 	ff := scratchFields.Get().(*encodedFields).
 		Reset().
 		Grow(len(fields) + len(v.fields))
-	v.fields = *ff.AppendEncoded(v.fields).AppendFields(fields)
+	// The context fields are already deduplicated.
+	*ff = append(*ff, v.fields...)
+	v.fields = *ff.AppendFields(fields, v.opts)
+	if v.loggerID != "" {
+		parent := v.loggerID
+		v.loggerID = newLoggerID()
+		v.fields = *(&v.fields).AppendFields([]Field{LoggerIDKey, v.loggerID, ParentLoggerKey, parent}, v.opts)
+	}
+	if v.elapsedKey != "" {
+		v.created = v.timeNow()
+	}
+	if v.maxContextFields > 0 && len(v.fields) > v.maxContextFields {
+		v.fields = v.fields.dropOldest(v.maxContextFields, v.schemaKey)
+	}
+	if v.dedupMap {
+		v.index = &fieldsIndex{fields: v.fields}
+	}
+	return v
+}
+
+// DroppedFieldsKey is the key of the number of the context fields dropped by WithMaxContextFields.
+const DroppedFieldsKey = "__dropped_fields"
+
+// WithMaxContextFields returns a copy of the ULog instance whose With keeps at most n context fields,
+// dropping the oldest ones - to bound the leak of a long-lived logger calling With in a loop.
+// When fields are dropped, the number of them is recorded under DroppedFieldsKey (besides the n fields),
+// as that is most likely a bug.
+// The schema version (see WithSchemaVersion) is never dropped, and stays the first field, besides the n fields.
+//
+// Non-positive n means no limit.
+func (u ULog) WithMaxContextFields(n int) ULog {
+	v := u
+	v.maxContextFields = n
+	return v
+}
+
+// fieldsIndex is the index of the keys of fields, see WithDedupMap.
+//
+// It is built on the first use, and shared by the copies of the ULog.
+type fieldsIndex struct {
+	once   sync.Once
+	fields encodedFields
+	m      map[string]int
+}
+
+// WithDedupMap returns a copy of the ULog instance which keeps a map index of the keys of its context fields,
+// so deduplicating the fields of Write against them costs O(1) per field,
+// instead of a scan of the context fields.
+//
+// This pays off for the loggers with dozens of context fields, writing many lines:
+// the index is built on the first Write of each logger (of each With), and kept for the next ones.
+func (u ULog) WithDedupMap() ULog {
+	v := u
+	v.dedupMap = true
+	v.index = &fieldsIndex{fields: v.fields}
+	return v
+}
+
+// contextIndex returns the index of the context fields (see WithDedupMap),
+// or nil if there is none, or the fields have been replaced since.
+func (u ULog) contextIndex() map[string]int {
+	if u.index == nil || len(u.index.fields) != len(u.fields) ||
+		len(u.fields) != 0 && &u.index.fields[0] != &u.fields[0] {
+		return nil
+	}
+	u.index.once.Do(func() { u.index.m = indexFields(u.index.fields) })
+	return u.index.m
+}
+
+const (
+	// LoggerIDKey is the key of the logger id, with WithLoggerID.
+	LoggerIDKey = "logger"
+	// ParentLoggerKey is the key of the id of the parent logger, with WithLoggerID.
+	ParentLoggerKey = "parent_logger"
+)
+
+var loggerSeq uint64
+
+func newLoggerID() string {
+	return strconv.FormatUint(atomic.AddUint64(&loggerSeq, 1), 36)
+}
+
+// WithLoggerID returns a copy of the ULog instance with a short, process-unique id under LoggerIDKey.
+// Each child (see With) gets its own id, and the id of its parent under ParentLoggerKey,
+// so the With-chains can be reconstructed from the log.
+func (u ULog) WithLoggerID() ULog {
+	v := u
+	v.loggerID = newLoggerID()
+	ff := append(make(encodedFields, 0, len(u.fields)+1), u.fields...)
+	v.fields = *ff.AppendFields([]Field{LoggerIDKey, v.loggerID}, v.opts)
+	return v
+}
+
+// WithWriter returns a copy of the ULog instance (with all its fields and options) which writes to w -
+// such as to route the logs of a sub-operation elsewhere, while keeping its context.
+func (u ULog) WithWriter(w io.Writer) ULog {
+	v := u
+	v.Writer = w
+	return v
+}
+
+// Clone returns a deep copy of the ULog instance, which shares no field memory with u.
+func (u ULog) Clone() ULog {
+	v := u
+	v.fields = append(encodedFields(nil), u.fields...)
+	v.dynamic = append([]dynamicField(nil), u.dynamic...)
+	return v
+}
+
+// Scoped calls fn with a child logger having the provided extra fields (such as "debug", true),
+// for detailed logging around a suspect operation. The fields do not leak out of fn.
+func (u ULog) Scoped(fn func(ULog), fields ...Field) {
+	fn(u.With(fields...))
+}
+
+// Merge returns a copy of the ULog instance with the context fields of other added.
+//
+// On key conflicts the field of other wins - use other.Merge(u) for the reverse precedence.
+// The writer and key names are kept from u.
+// The schema version (see WithSchemaVersion) stays the first field.
+func (u ULog) Merge(other ULog) ULog {
+	v := u
+	ff := scratchFields.Get().(*encodedFields).
+		Reset().
+		Grow(len(u.fields) + len(other.fields))
+	v.fields = *ff.AppendEncoded(u.fields).AppendEncoded(other.fields)
+	if other.schemaKey != "" {
+		v.schemaKey = other.schemaKey
+	}
+	if v.schemaKey != "" {
+		if i := v.fields.Index(v.schemaKey); i > 0 {
+			f := v.fields[i]
+			copy(v.fields[1:i+1], v.fields[:i])
+			v.fields[0] = f
+		}
+	}
+	return v
+}
+
+// WithSchemaVersion returns a copy of the ULog instance with the log schema version
+// preset under DefaultSchemaVersionKey, as the first field after the timestamp and the message.
+func (u ULog) WithSchemaVersion(version int) ULog {
+	return u.WithSchemaVersionKey(DefaultSchemaVersionKey, version)
+}
+
+// WithSchemaVersionKey is like WithSchemaVersion, but with a custom key.
+func (u ULog) WithSchemaVersionKey(key string, version int) ULog {
+	v := u
+	ff := make(encodedFields, 0, 1+len(u.fields))
+	ff.AppendFields([]Field{key, version}, u.opts)
+	for _, f := range u.fields {
+		if f.Key() != ff[0].Key() {
+			ff = append(ff, f)
+		}
+	}
+	v.fields, v.schemaKey = ff, ff[0].Key()
 	return v
 }
 
 // WithKeyNames returns a copy of the ULog instance with the provided key names for timestamp and message keys.
+//
+// The keys are escaped as needed (such as a key with a quote in it), so the lines stay valid JSON.
 func (u ULog) WithKeyNames(timestampKey, messageKey string) ULog {
 	v := u
 	if timestampKey == "" {
@@ -61,6 +294,403 @@ func (u ULog) WithKeyNames(timestampKey, messageKey string) ULog {
 	return v
 }
 
+// WithTimestampKey returns a copy of the ULog instance with the provided key name for the timestamp,
+// keeping the message key.
+func (u ULog) WithTimestampKey(key string) ULog {
+	return u.WithKeyNames(key, u.MessageKey)
+}
+
+// WithMessageKey returns a copy of the ULog instance with the provided key name for the message,
+// keeping the timestamp key.
+func (u ULog) WithMessageKey(key string) ULog {
+	return u.WithKeyNames(u.TimestampKey, key)
+}
+
+// WithOmitEmptyMessage returns a copy of the ULog instance which omits the message key
+// when the message is empty.
+//
+// Useful when ULog is used purely as a field emitter.
+func (u ULog) WithOmitEmptyMessage() ULog {
+	v := u
+	v.omitEmptyMessage = true
+	return v
+}
+
+// Format is the output encoding of the lines.
+type Format uint8
+
+// FormatJSON is the default, JSON text output.
+//
+// The other formats (such as FormatCBOR) need build tags.
+const FormatJSON = Format(0)
+
+// formatEncoders transcode the JSON object of a line (without the line prefix) to the other formats,
+// as registered by those with build tags.
+var formatEncoders = make(map[Format]func([]byte) ([]byte, error))
+
+// WithFormat returns a copy of the ULog instance which writes its lines in the given format.
+//
+// When a line cannot be transcoded (such as a format not built in), it is not written,
+// but reported with the JSON line to the error sink (see WithErrorSink), or DefaultWriter if there is none.
+func (u ULog) WithFormat(format Format) ULog {
+	v := u
+	v.format = format
+	return v
+}
+
+// WithFoldedMessages returns a copy of the ULog instance which replaces the runs of whitespace
+// (including the line breaks) in the messages with single spaces, and trims them.
+func (u ULog) WithFoldedMessages() ULog {
+	v := u
+	v.foldMessages = true
+	return v
+}
+
+// WithNDJSON returns a copy of the ULog instance which guarantees strict NDJSON output:
+// each line is exactly one JSON object, without surrounding whitespace, terminated by a single "\n".
+//
+// The line prefix (see WithLinePrefix) is not written, as it would make the line invalid.
+func (u ULog) WithNDJSON() ULog {
+	v := u
+	v.ndjson = true
+	return v
+}
+
+// WithOmitEmpty returns a copy of the ULog instance which omits the fields with an empty string ("") or null value.
+func (u ULog) WithOmitEmpty() ULog {
+	v := u
+	v.omitEmpty = true
+	return v
+}
+
+// WithOmitEmptyString returns a copy of the ULog instance which (with WithOmitEmpty)
+// omits the fields with an empty string value iff omit - the null values are omitted regardless.
+func (u ULog) WithOmitEmptyString(omit bool) ULog {
+	v := u
+	v.keepEmptyString = !omit
+	return v
+}
+
+// WithLinePrefix returns a copy of the ULog instance which starts each line with token and a space,
+// before the JSON object - for grepping before parsing. Consumers must strip the prefix.
+func (u ULog) WithLinePrefix(token string) ULog {
+	v := u
+	v.linePrefix = token
+	return v
+}
+
+// WithFieldCount returns a copy of the ULog instance which ends each line with a field under key,
+// holding the number of fields of the line (including itself, the timestamp and the message),
+// so consumers can detect truncated lines.
+func (u ULog) WithFieldCount(key string) ULog {
+	v := u
+	v.fieldCountKey = escapeRawKey(key)
+	return v
+}
+
+// WithMaxLineBytes returns a copy of the ULog instance which keeps each line at most n bytes long,
+// by dropping the trailing fields (and the message, if needed) and appending a TruncatedKey: true field.
+// The line stays valid JSON. The timestamp is always kept, so n must be large enough for that.
+//
+// Non-positive n means no limit.
+func (u ULog) WithMaxLineBytes(n int) ULog {
+	v := u
+	v.maxLineBytes = n
+	return v
+}
+
+// WithoutHTMLEscape returns a copy of the ULog instance which does not escape
+// <, > and & in the message and the field values.
+//
+// As the context fields are encoded by With, this only affects the fields added afterwards:
+// call it before With.
+func (u ULog) WithoutHTMLEscape() ULog {
+	return u.WithEscapeHTML(false)
+}
+
+// WithEscapeHTML returns a copy of the ULog instance which escapes
+// <, > and & in the message and the field values iff escape is true (this is the default).
+//
+// Just as WithoutHTMLEscape, this does not affect the already added context fields.
+func (u ULog) WithEscapeHTML(escape bool) ULog {
+	v := u
+	v.opts.noHTMLEscape = !escape
+	return v
+}
+
+// WithErrorCauses returns a copy of the ULog instance which emits the Error() strings of
+// the chain of wrapped errors, outermost first, as an array next to each error field,
+// under the key of the error field with CausesSuffix appended (such as "error_causes").
+func (u ULog) WithErrorCauses() ULog {
+	v := u
+	v.opts.errorCauses = true
+	return v
+}
+
+// WithTypeAnnotations returns a copy of the ULog instance which emits the Go type (as with %T) of each field value
+// next to it, under the key of the field with TypeSuffix appended (such as "error_type") -
+// for debugging why a value is encoded unexpectedly, such as a typed nil.
+//
+// This is a diagnostic aid, not meant for production.
+// The context fields added by an earlier With are not annotated.
+func (u ULog) WithTypeAnnotations() ULog {
+	v := u
+	v.opts.typeAnnotations = true
+	return v
+}
+
+// WithTypeEncoder returns a copy of the ULog instance which emits the field values
+// of the same type as sample as the string returned by fn - such as the canonical form of an UUID.
+func (u ULog) WithTypeEncoder(sample interface{}, fn func(interface{}) string) ULog {
+	v := u
+	m := make(map[reflect.Type]func(interface{}) string, len(u.opts.typeEncoders)+1)
+	for k, f := range u.opts.typeEncoders {
+		m[k] = f
+	}
+	m[reflect.TypeOf(sample)] = fn
+	v.opts.typeEncoders = m
+	return v
+}
+
+// WithTimeFieldFormat returns a copy of the ULog instance which formats the time.Time
+// field values with layout (as time.Format), instead of RFC3339Nano.
+func (u ULog) WithTimeFieldFormat(layout string) ULog {
+	v := u
+	v.opts.timeFormat = layout
+	return v
+}
+
+// WithZeroTimeAsNull returns a copy of the ULog instance which writes the zero time.Time field values
+// as null, instead of "0001-01-01T00:00:00Z".
+//
+// The zero times of the context fields added by an earlier With stay as they were encoded.
+func (u ULog) WithZeroTimeAsNull() ULog {
+	v := u
+	v.opts.zeroTimeNull = true
+	return v
+}
+
+// WithBoolAsString returns a copy of the ULog instance which writes the bool field values
+// as "true" and "false" strings - for pipelines where the same field may be a string, too.
+//
+// The context fields added by an earlier With keep their booleans.
+func (u ULog) WithBoolAsString() ULog {
+	v := u
+	v.opts.boolAsString = true
+	return v
+}
+
+// WithKeySanitizer returns a copy of the ULog instance which passes every field key through sanitize,
+// such as to replace the spaces and dots disliked by some log backends.
+//
+// The keys of the context fields added by an earlier With are not sanitized.
+func (u ULog) WithKeySanitizer(sanitize func(string) string) ULog {
+	v := u
+	v.opts.keySanitizer = sanitize
+	return v
+}
+
+// WithUnredactedURLs returns a copy of the ULog instance which writes the *url.URL field values
+// with their passwords - by default, the passwords are redacted (see url.URL.Redacted).
+//
+// The URLs of the context fields added by an earlier With stay redacted.
+func (u ULog) WithUnredactedURLs() ULog {
+	v := u
+	v.opts.unredactedURLs = true
+	return v
+}
+
+// WithNoDedup returns a copy of the ULog instance which does not check the field keys for duplicates,
+// saving the quadratic cost of the check for large field sets.
+//
+// The caller must guarantee unique keys: duplicates are emitted as is, resulting in duplicate
+// keys in the JSON object, which many consumers handle poorly.
+func (u ULog) WithNoDedup() ULog {
+	v := u
+	v.opts.noDedup = true
+	return v
+}
+
+// WithMaxKeyLen returns a copy of the ULog instance which truncates the field keys longer than n bytes
+// to n bytes, appending TruncatedKeyMarker - bounding the line size with pathological keys.
+// Non-positive n means no limit.
+func (u ULog) WithMaxKeyLen(n int) ULog {
+	v := u
+	v.opts.maxKeyLen = n
+	return v
+}
+
+// WithFieldOrder returns a copy of the ULog instance which writes the fields with the given keys first
+// (after the timestamp and the message), in the given order, then the rest in insertion order.
+func (u ULog) WithFieldOrder(order []string) ULog {
+	v := u
+	v.fieldOrder = append([]string(nil), order...)
+	return v
+}
+
+// WithFieldComparator returns a copy of the ULog instance which writes the fields
+// (after the timestamp and the message) sorted by less, called with their keys as escaped in JSON, without the quotes -
+// such as for the reserved keys first, then the rest alphabetically.
+//
+// The sort is stable, so the fields less deems equal keep their order (see WithFieldOrder). A nil less turns it off.
+func (u ULog) WithFieldComparator(less func(a, b string) bool) ULog {
+	v := u
+	v.fieldLess = less
+	return v
+}
+
+// fieldSorter sorts the fields by their unquoted keys.
+type fieldSorter struct {
+	eF   encodedFields
+	less func(a, b string) bool
+}
+
+func (fs fieldSorter) Len() int      { return len(fs.eF) }
+func (fs fieldSorter) Swap(i, j int) { fs.eF[i], fs.eF[j] = fs.eF[j], fs.eF[i] }
+func (fs fieldSorter) Less(i, j int) bool {
+	return fs.less(unquoteKey(fs.eF[i].Key()), unquoteKey(fs.eF[j].Key()))
+}
+
+// unquoteKey returns the encoded key without its quotes.
+func unquoteKey(key string) string {
+	if len(key) >= 2 && key[0] == '"' && key[len(key)-1] == '"' {
+		return key[1 : len(key)-1]
+	}
+	return key
+}
+
+// DefaultTimeEncoder appends the timestamp of the line (in UTC) to dst, as written by default.
+func DefaultTimeEncoder(dst []byte, t time.Time) []byte {
+	return append(t.AppendFormat(dst, timeFormat), 'Z')
+}
+
+// WithTimeEncoder returns a copy of the ULog instance which uses enc to append the timestamp
+// (the UTC time, to be written between the quotes) of each line to dst - see DefaultTimeEncoder.
+//
+// This overrides WithNanoTimestamp.
+func (u ULog) WithTimeEncoder(enc func(dst []byte, t time.Time) []byte) ULog {
+	v := u
+	v.timeEncoder = enc
+	return v
+}
+
+// DefaultUnixTimestampKey is the default key of the epoch milliseconds, with WithDualTimestamp.
+const DefaultUnixTimestampKey = "ts_unix"
+
+// WithDualTimestamp returns a copy of the ULog instance which writes the timestamp of each line
+// as epoch milliseconds too, under DefaultUnixTimestampKey (right after the timestamp key),
+// from the same instant.
+func (u ULog) WithDualTimestamp() ULog {
+	return u.WithDualTimestampKey(DefaultUnixTimestampKey)
+}
+
+// WithDualTimestampKey is like WithDualTimestamp, but with a custom key; the empty key switches it off.
+func (u ULog) WithDualTimestampKey(key string) ULog {
+	v := u
+	v.unixTimestampKey = escapeRawKey(key)
+	return v
+}
+
+// WithNanoTimestamp returns a copy of the ULog instance which writes the timestamps with nanosecond
+// (instead of microsecond) precision.
+func (u ULog) WithNanoTimestamp() ULog {
+	v := u
+	v.nanoTimestamp = true
+	return v
+}
+
+// WithClock returns a copy of the ULog instance which uses now instead of time.Now.
+//
+// Useful for tests.
+func (u ULog) WithClock(now func() time.Time) ULog {
+	v := u
+	v.now = now
+	return v
+}
+
+// WithThrottle returns a copy of the ULog instance which emits the same message
+// at most once per the given interval.
+//
+// The number of suppressed lines is reported in the SuppressedKey field of the next emitted line,
+// overriding any field of the same key. The count is dropped if the message is not repeated
+// for ten intervals after its last emission.
+// The throttling state is shared with the children of the returned logger.
+func (u ULog) WithThrottle(perKey time.Duration) ULog {
+	v := u
+	v.throttle = &throttle{interval: perKey, seen: make(map[string]*throttleState)}
+	return v
+}
+
+// WithElapsed returns a copy of the ULog instance which includes the milliseconds elapsed
+// since the creation of the logger (by WithElapsed or With) under key in every line.
+func (u ULog) WithElapsed(key string) ULog {
+	v := u
+	v.elapsedKey, v.created = key, v.timeNow()
+	return v
+}
+
+// DurationKey is the key of the measured milliseconds, written by Timer.
+const DurationKey = "duration_ms"
+
+// Timer returns a func which writes msg with the fields and the milliseconds elapsed since calling Timer
+// under DurationKey:
+//
+//	defer logger.Timer("handler done")()
+func (u ULog) Timer(msg string, fields ...Field) func() {
+	start := u.timeNow()
+	return func() {
+		u.Write(msg, append(fields[:len(fields):len(fields)], DurationKey, u.timeNow().Sub(start).Milliseconds())...)
+	}
+}
+
+// WithDynamicField returns a copy of the ULog instance which evaluates fn on every Write,
+// and includes its result under key.
+//
+// Useful for rapidly changing values, such as the active connection count.
+// The fields of the actual Write call override the dynamic fields.
+func (u ULog) WithDynamicField(key string, fn func() interface{}) ULog {
+	v := u
+	v.dynamic = append(u.dynamic[:len(u.dynamic):len(u.dynamic)], dynamicField{key: key, fn: fn})
+	return v
+}
+
+// WithIDSource returns a copy of the ULog instance which reads the random bytes for WithNewID from r,
+// instead of crypto/rand.Reader.
+func (u ULog) WithIDSource(r io.Reader) ULog {
+	v := u
+	v.idSource = r
+	return v
+}
+
+// WithNewID returns a child logger with a freshly generated random ID under key.
+//
+// Handy at the start of a request to tag all subsequent lines.
+//
+// If the ID source fails, the ID is the hex timestamp and a process-wide sequence number,
+// prefixed with "seq-" to make it recognizable as non-random.
+func (u ULog) WithNewID(key string) ULog {
+	r := u.idSource
+	if r == nil {
+		r = rand.Reader
+	}
+	var a [16]byte
+	if _, err := io.ReadFull(r, a[:]); err != nil {
+		return u.With(key, "seq-"+strconv.FormatInt(u.timeNow().UnixNano(), 16)+
+			"-"+strconv.FormatUint(atomic.AddUint64(&idSeq, 1), 16))
+	}
+	return u.With(key, hex.EncodeToString(a[:]))
+}
+
+// idSeq is the sequence number of the fallback IDs of WithNewID.
+var idSeq uint64
+
+func (u ULog) timeNow() time.Time {
+	if u.now != nil {
+		return u.now()
+	}
+	return time.Now()
+}
+
 // Log makes ULog implement github.com/go-kit/kit/log.Logger.
 func (u ULog) Log(keyvals ...interface{}) error {
 	if len(keyvals) == 0 {
@@ -118,19 +748,271 @@ const (
 	DefaultTimestampKey = "ts"
 	DefaultMessageKey   = "msg"
 
-	timeFormat = "2006-01-02T15:04:05.999999"
+	DefaultSchemaVersionKey = "v"
+
+	timeFormat     = "2006-01-02T15:04:05.999999"
+	nanoTimeFormat = "2006-01-02T15:04:05.999999999"
 )
 
+// WriteErrorReturn writes msg with err (with its stack trace) under the "error" key, and returns err.
+//
+// Useful as return logger.WriteErrorReturn("failed", err).
+// If err is nil, nothing is written, and nil is returned.
+func (u ULog) WriteErrorReturn(msg string, err error, fields ...Field) error {
+	if err == nil {
+		return nil
+	}
+	var we *wrappedErr
+	walkErrors(err, func(err error) bool {
+		we, _ = err.(*wrappedErr)
+		return we == nil
+	})
+	logged := err
+	if we == nil {
+		logged = wrapError(err, 3)
+	}
+	u.Write(msg, append(append(make([]Field, 0, 2+len(fields)), "error", logged), fields...)...)
+	return err
+}
+
+// lineCut is a possible truncation point of a line, after count fields.
+type lineCut struct {
+	off, count int
+}
+
+// TruncatedKey marks the lines truncated by WithMaxLineBytes.
+const TruncatedKey = "__truncated"
+
+// foldWhitespace replaces the runs of whitespace in s with single spaces, and trims it.
+func foldWhitespace(s string) string {
+	prevSpace := true
+	for _, r := range s {
+		isSpace := unicode.IsSpace(r)
+		if isSpace && (prevSpace || r != ' ') {
+			return strings.Join(strings.Fields(s), " ")
+		}
+		prevSpace = isSpace
+	}
+	if prevSpace && s != "" {
+		return strings.TrimRightFunc(s, unicode.IsSpace)
+	}
+	return s
+}
+
+// ndjsonLine normalizes the assembled line in sb to a single NDJSON line.
+//
+// Raw line breaks may only be whitespace between the JSON tokens (they are escaped in strings),
+// so they are replaced with spaces.
+func ndjsonLine(sb *bytes.Buffer) {
+	b := bytes.TrimSpace(sb.Bytes())
+	for i, c := range b {
+		if c == '\n' || c == '\r' {
+			b[i] = ' '
+		}
+	}
+	n := copy(sb.Bytes(), b)
+	sb.Truncate(n)
+	sb.WriteByte('\n')
+}
+
+// transcode the JSON object of a line to the format of u.
+func (u ULog) transcode(object []byte) ([]byte, error) {
+	encode := formatEncoders[u.format]
+	if encode == nil {
+		return nil, fmt.Errorf("format %d is not built in", u.format)
+	}
+	return encode(object)
+}
+
+// reportFormatError writes the failure to transcode the JSON line, and the line itself,
+// to the error sink or DefaultWriter, instead of mixing JSON into the stream of the format.
+func (u ULog) reportFormatError(line []byte, err error) {
+	w := u.errorSink
+	if w == nil {
+		w = DefaultWriter
+	}
+	WithWriter(w).Write("transcode line", "format", u.format, "error", err, "line", string(line))
+}
+
+// escapeRawKey returns key escaped to be written between quotes, if it contains characters
+// which would make the JSON invalid (quote, backslash or control characters).
+func escapeRawKey(key string) string {
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c < 0x20 || c == '"' || c == '\\' {
+			k := encodeKey(key)
+			return k[1 : len(k)-1]
+		}
+	}
+	return key
+}
+
+// isKey reports whether the encoded key is the quoted form of the (escaped, see escapeRawKey) raw key.
+func isKey(encoded, raw string) bool {
+	if raw == "" {
+		return false
+	}
+	if len(encoded) == len(raw)+2 && encoded[1:len(encoded)-1] == raw {
+		return true
+	}
+	// The same key may be escaped differently, such as "<" as "\u003c" with the HTML escaping.
+	if strings.IndexByte(encoded, '\\') < 0 && strings.IndexByte(raw, '\\') < 0 {
+		return false
+	}
+	var a, b string
+	return json.Unmarshal([]byte(encoded), &a) == nil &&
+		json.Unmarshal([]byte(`"`+raw+`"`), &b) == nil && a == b
+}
+
+// isPlainString reports whether s consists only of printable ASCII characters
+// that need no escaping in JSON (HTML-escaping included).
+func isPlainString(s string) bool {
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c < 0x20 || c >= 0x7f, c == '"', c == '\\', c == '<', c == '>', c == '&':
+			return false
+		}
+	}
+	return true
+}
+
 // Write a JSON message to the configured writer or os.Stderr.
 //
 // Includes the message with the key `msg`. Includes the timestamp with the
 // key `ts`. The timestamp field is always first and the message second.
+// A time.Time (or RFC3339 string) field with the timestamp key is used as the timestamp,
+// instead of the current time - for replaying events.
 //
 // Fields in context will not be overridden. ULog will log the same key
 // multiple times if it is set multiple times. If you don't want that, don't
 // specify it multiple times.
 func (u ULog) Write(msg string, fields ...Field) {
-	now := time.Now().UTC()
+	u.write(msg, msg != "" || !u.omitEmptyMessage, fields)
+}
+
+// WriteTo is like Write, but writes the line to w instead of the Writer of the ULog instance -
+// such as an audit line to a special sink.
+func (u ULog) WriteTo(w io.Writer, msg string, fields ...Field) {
+	u.Writer = w
+	u.Write(msg, fields...)
+}
+
+// WriteKV is like Write, but with typed key-value pairs instead of the alternating keys and values.
+func (u ULog) WriteKV(msg string, kvs ...KV) {
+	fields := make([]Field, 0, 2*len(kvs))
+	for _, kv := range kvs {
+		fields = append(fields, kv.Key, kv.Value)
+	}
+	u.Write(msg, fields...)
+}
+
+// WriteFields writes a JSON message with the timestamp and the fields, without any message key.
+//
+// Useful when ULog is used as a pure event emitter.
+func (u ULog) WriteFields(fields ...Field) {
+	u.write("", false, fields)
+}
+
+const (
+	// maxPooledBuffer is the capacity above which a line buffer is not put back into the pool.
+	maxPooledBuffer = 64 << 10
+	// maxPooledFields is the capacity above which an encodedFields is not put back into the pool.
+	maxPooledFields = 1024
+)
+
+// HeaderKey marks the header line written by WriteHeader.
+const HeaderKey = "__header"
+
+// WriteHeader writes a header line, with HeaderKey: true, the timestamp, the context and the given fields,
+// but no message - such as the schema version, the hostname and the start time, once at the start of a stream.
+//
+// The header has no default level (see WithDefaultLevel).
+func (u ULog) WriteHeader(fields ...Field) {
+	v := u
+	v.defaultLevel = 0
+	v.write("", false, append([]Field{HeaderKey, true}, fields...))
+}
+
+// WriteMemStats writes msg with the alloc, heap_objects, num_gc and goroutines fields,
+// from runtime.ReadMemStats and runtime.NumGoroutine - for on-demand diagnostics.
+//
+// Note that runtime.ReadMemStats stops the world, so do not call this too often.
+func (u ULog) WriteMemStats(msg string) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	u.Write(msg, "alloc", ms.Alloc, "heap_objects", ms.HeapObjects, "num_gc", ms.NumGC,
+		"goroutines", runtime.NumGoroutine())
+}
+
+// explicitTimestamp returns the time.Time (or RFC3339 string) value of the timestamp key in fields,
+// for replaying events with their original timestamp.
+func explicitTimestamp(fields []Field, key string) (time.Time, bool) {
+	if key == "" {
+		key = DefaultTimestampKey
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		if k, ok := fields[i].(string); !ok || k != key {
+			continue
+		}
+		switch x := fields[i+1].(type) {
+		case time.Time:
+			return x, true
+		case *time.Time:
+			if x != nil {
+				return *x, true
+			}
+		case string:
+			if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// write the line, with the message iff withMsg.
+func (u ULog) write(msg string, withMsg bool, fields []Field) {
+	// Nothing would be written, so do not format anything.
+	if u.Writer == ioutil.Discard && u.errorSink == nil && len(u.hooks) == 0 {
+		return
+	}
+	now := u.timeNow().UTC()
+	if t, ok := explicitTimestamp(fields, u.TimestampKey); ok {
+		now = t.UTC()
+	}
+	if u.foldMessages {
+		msg = foldWhitespace(msg)
+	}
+	if u.throttle != nil && withMsg {
+		suppressed, ok := u.throttle.allow(msg, now)
+		if !ok {
+			return
+		}
+		if suppressed != 0 {
+			fields = append(fields[:len(fields):len(fields)], SuppressedKey, suppressed)
+		}
+	}
+	fields = u.defaultLevelFields(fields)
+	if global, _ := globalFields.Load().([]dynamicField); len(u.dynamic) != 0 || len(global) != 0 {
+		ff := make([]Field, 0, 2*(len(global)+len(u.dynamic))+len(fields))
+		for _, d := range global {
+			ff = append(ff, d.key, d.fn())
+		}
+		for _, d := range u.dynamic {
+			ff = append(ff, d.key, d.fn())
+		}
+		fields = append(ff, fields...)
+	}
+	if u.elapsedKey != "" {
+		fields = append(fields[:len(fields):len(fields)], u.elapsedKey, now.Sub(u.created).Milliseconds())
+	}
+	if u.callerDepth > 0 {
+		fields = append(fields[:len(fields):len(fields)], CallersKey, callerStack(u.callerDepth))
+	}
+	if u.callerOnError && u.isErrorLine(fields) {
+		if callers := callerStack(1); len(callers) != 0 {
+			fields = append(fields[:len(fields):len(fields)], CallerKey, callers[0])
+		}
+	}
 
 	tsKey := u.TimestampKey
 	if tsKey == "" {
@@ -140,16 +1022,36 @@ func (u ULog) Write(msg string, fields ...Field) {
 	if msgKey == "" {
 		msgKey = DefaultMessageKey
 	}
+	// The keys are written between literal quotes.
+	tsKey, msgKey = escapeRawKey(tsKey), escapeRawKey(msgKey)
 
-	eF := scratchFields.Get().(*encodedFields).
-		Reset().
-		Grow(len(u.fields) + len(fields)/2).
-		AppendEncoded(u.fields).AppendFields(fields)
+	// Fast path: without fields, the field machinery is skipped entirely.
+	var eF *encodedFields
+	var ff encodedFields
+	var js *jsonEncoder
+	if len(u.fields) != 0 || len(fields) != 0 {
+		// The encoded strings point into the arena of js, till the line is written:
+		// they must not escape this function (see encodedFields.detach).
+		js = scratchJS.Get().(*jsonEncoder)
+		js.SetOptions(u.opts)
+		js.borrowArena()
+		eF = scratchFields.Get().(*encodedFields).
+			Reset().
+			Grow(len(u.fields)+len(fields)/2).
+			appendRaw(u.fields).appendFieldsIndexed(fields, js, u.contextIndex())
+		ff = *eF
+		if len(u.fieldOrder) != 0 {
+			ff.reorder(u.fieldOrder, js)
+		}
+		if u.fieldLess != nil {
+			sort.Stable(fieldSorter{eF: ff, less: u.fieldLess})
+		}
+	}
 
 	var fieldsLen int
-	for _, field := range *eF {
+	for _, field := range ff {
 		key := field.Key()
-		if key == msgKey || key == tsKey {
+		if isKey(key, msgKey) || isKey(key, tsKey) {
 			continue
 		}
 		fieldsLen += 2 + len(key) + 2 + len(field.Value())
@@ -157,47 +1059,171 @@ func (u ULog) Write(msg string, fields ...Field) {
 
 	sb := scratchBuffers.Get().(*bytes.Buffer)
 	sb.Reset()
-	sb.Grow(3 + len(tsKey) + 4 + len(timeFormat) + 5 + len(msgKey) + 3 + 1 + len(msg) + 1 + fieldsLen + 3)
+	sb.Grow(len(u.linePrefix) + 1 + 3 + len(tsKey) + 4 + len(nanoTimeFormat) + 5 + len(msgKey) + 3 + 1 + len(msg) + 1 + fieldsLen + 3)
+	var prefixLen int
+	if u.linePrefix != "" && !u.ndjson {
+		sb.WriteString(u.linePrefix)
+		sb.WriteByte(' ')
+		prefixLen = sb.Len()
+	}
 	sb.WriteString(`{ "`)
 	sb.WriteString(tsKey)
 	sb.WriteString(`": "`)
-	var a [len(timeFormat)]byte
-	sb.Write(now.AppendFormat(a[:0], timeFormat))
-	sb.WriteString(`Z", "`)
-	sb.WriteString(msgKey)
-	sb.WriteString(`": `)
-
-	{
-		n := sb.Len()
-		enc := json.NewEncoder(sb)
-		if err := enc.Encode(msg); err != nil {
-			sb.Truncate(n)
-			enc.Encode(fmt.Sprintf("%v", msg))
+	if u.timeEncoder != nil {
+		// Let the encoder append right into the free capacity of sb.
+		sb.Grow(len(nanoTimeFormat) + 1)
+		sb.Write(u.timeEncoder(sb.Bytes()[sb.Len():], now))
+	} else {
+		layout := timeFormat
+		if u.nanoTimestamp {
+			layout = nanoTimeFormat
 		}
+		var a [len(nanoTimeFormat) + 1]byte
+		sb.Write(append(now.AppendFormat(a[:0], layout), 'Z'))
 	}
-	if sb.Bytes()[sb.Len()-1] == '\n' {
-		sb.Truncate(sb.Len() - 1)
+	sb.WriteByte('"')
+	count := 1
+	if u.unixTimestampKey != "" {
+		sb.WriteString(`, "`)
+		sb.WriteString(u.unixTimestampKey)
+		sb.WriteString(`": `)
+		var a [20]byte
+		sb.Write(strconv.AppendInt(a[:0], now.UnixNano()/int64(time.Millisecond), 10))
+		count++
 	}
 
-	for _, field := range *eF {
+	// The possible truncation points, for maxLineBytes.
+	var cuts []lineCut
+	if u.maxLineBytes > 0 {
+		cuts = append(make([]lineCut, 0, 2+len(ff)), lineCut{off: sb.Len(), count: count})
+	}
+
+	if withMsg {
+		sb.WriteString(`, "`)
+		sb.WriteString(msgKey)
+		sb.WriteString(`": `)
+		if isPlainString(msg) {
+			// Nothing to escape, spare the encoder allocation.
+			sb.WriteByte('"')
+			sb.WriteString(msg)
+			sb.WriteByte('"')
+		} else {
+			n := sb.Len()
+			enc := json.NewEncoder(sb)
+			enc.SetEscapeHTML(!u.opts.noHTMLEscape)
+			if err := enc.Encode(msg); err != nil {
+				sb.Truncate(n)
+				enc.Encode(fmt.Sprintf("%v", msg))
+			}
+			if sb.Bytes()[sb.Len()-1] == '\n' {
+				sb.Truncate(sb.Len() - 1)
+			}
+		}
+	}
+
+	if withMsg {
+		count++
+		if cuts != nil {
+			cuts = append(cuts, lineCut{off: sb.Len(), count: count})
+		}
+	}
+	for _, field := range ff {
 		key := field.Key()
-		if key == msgKey || key == tsKey {
+		if isKey(key, msgKey) || isKey(key, tsKey) || isKey(key, u.fieldCountKey) || isKey(key, u.unixTimestampKey) {
 			continue
 		}
+		if u.omitEmpty {
+			if value := field.Value(); value == "null" || value == `""` && !u.keepEmptyString {
+				continue
+			}
+		}
 		sb.WriteString(", ")
 		sb.WriteString(key)
 		sb.WriteString(`: `)
 		sb.WriteString(field.Value())
+		count++
+		if cuts != nil {
+			cuts = append(cuts, lineCut{off: sb.Len(), count: count})
+		}
+	}
+	if cuts != nil {
+		// The closing, with the field count.
+		tail := 3
+		if u.fieldCountKey != "" {
+			tail += 4 + len(u.fieldCountKey) + 3 + 20
+		}
+		if sb.Len()+tail > u.maxLineBytes {
+			const truncated = `, "` + TruncatedKey + `": true`
+			cut := cuts[0]
+			for _, c := range cuts[1:] {
+				if c.off+len(truncated)+tail > u.maxLineBytes {
+					break
+				}
+				cut = c
+			}
+			sb.Truncate(cut.off)
+			sb.WriteString(truncated)
+			count = cut.count + 1
+		}
+	}
+	if u.fieldCountKey != "" {
+		sb.WriteString(`, "`)
+		sb.WriteString(u.fieldCountKey)
+		sb.WriteString(`": `)
+		sb.WriteString(strconv.Itoa(count + 1))
 	}
 	sb.WriteString(" }\n")
+	if u.ndjson {
+		ndjsonLine(sb)
+	}
 
 	w := u.Writer
 	if w == nil {
 		w = DefaultWriter
 	}
-	_, _ = w.Write(sb.Bytes())
+	line := sb.Bytes()
+	if u.format != FormatJSON {
+		b, err := u.transcode(line[prefixLen:])
+		if err != nil {
+			u.reportFormatError(line, err)
+			releaseScratch(sb, eF, js)
+			return
+		}
+		line = b
+	}
+	_, _ = w.Write(line)
+	if u.errorSink != nil && lineLevel(sb.Bytes(), u.getLevelKey()) >= Error {
+		_, _ = u.errorSink.Write(line)
+	}
+	if u.stats != nil {
+		atomic.AddUint64(&u.stats.lines, 1)
+		atomic.AddUint64(&u.stats.bytes, uint64(len(line)))
+	}
+	if len(u.hooks) != 0 {
+		// The hooks may keep the fields, which must not point into the arena.
+		e := HookEntry{Time: now, Line: line, Meta: u.meta, fields: ff.detach()}
+		if withMsg {
+			e.Message = msg
+		}
+		for _, hook := range u.hooks {
+			hook(e)
+		}
+	}
+	releaseScratch(sb, eF, js)
+}
 
-	scratchFields.Put(eF.Reset())
-	sb.Reset()
-	scratchBuffers.Put(sb)
+// releaseScratch puts the scratch buffers of write back to their pools.
+func releaseScratch(sb *bytes.Buffer, eF *encodedFields, js *jsonEncoder) {
+	if eF != nil {
+		if cap(*eF) <= maxPooledFields {
+			scratchFields.Put(eF.Reset())
+		}
+		js.releaseArena()
+		scratchJS.Put(js)
+	}
+	// Do not keep the buffers of an exceptionally long line around.
+	if sb.Cap() <= maxPooledBuffer {
+		sb.Reset()
+		scratchBuffers.Put(sb)
+	}
 }
@@ -0,0 +1,47 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+
+	json "github.com/goccy/go-json"
+)
+
+// KV is a key-value pair.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedMap is a JSON object which keeps the order of its keys.
+//
+// The keys of plain maps (even nested ones) are always emitted sorted, as by encoding/json;
+// use an OrderedMap value for insertion (or any custom) order.
+type OrderedMap []KV
+
+// MarshalJSON encodes the map as a JSON object, with the keys in the order of the slice.
+func (m OrderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, kv := range m {
+		if i != 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"context"
+	stdjson "encoding/json"
+	"time"
+)
+
+// OTelRecord is a log record, as exported to OpenTelemetry.
+type OTelRecord struct {
+	Timestamp time.Time
+	// Body is the message.
+	Body string
+	// Attributes are the fields, with their values decoded from JSON
+	// (string, float64, bool, nil, []interface{} or map[string]interface{}).
+	Attributes []KV
+}
+
+// OTelExporter exports the log records.
+//
+// This keeps the OpenTelemetry dependency out of ulog: a few lines of adapter
+// can convert the records to the LogRecords of the OpenTelemetry SDK's log exporter.
+type OTelExporter interface {
+	Export(ctx context.Context, records []OTelRecord) error
+}
+
+// NewOTelHook returns a hook (see WithHook) which exports each line to exporter,
+// with the timestamp, the message as body, and the fields as attributes.
+//
+// The errors of the exporter are ignored, as logging must not fail.
+func NewOTelHook(exporter OTelExporter) func(HookEntry) {
+	return func(e HookEntry) {
+		rec := OTelRecord{Timestamp: e.Time, Body: e.Message, Attributes: make([]KV, 0, e.NumFields())}
+		for i := 0; i < e.NumFields(); i++ {
+			k, v := e.Field(i)
+			var kv KV
+			if err := stdjson.Unmarshal([]byte(k), &kv.Key); err != nil {
+				continue
+			}
+			if err := stdjson.Unmarshal([]byte(v), &kv.Value); err != nil {
+				kv.Value = v
+			}
+			rec.Attributes = append(rec.Attributes, kv)
+		}
+		_ = exporter.Export(context.Background(), []OTelRecord{rec})
+	}
+}
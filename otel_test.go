@@ -0,0 +1,45 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+type mockExporter struct {
+	records []ulog.OTelRecord
+}
+
+func (m *mockExporter) Export(ctx context.Context, records []ulog.OTelRecord) error {
+	m.records = append(m.records, records...)
+	return nil
+}
+
+func TestOTelHook(t *testing.T) {
+	var buffer bytes.Buffer
+	var exp mockExporter
+	now := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	logger := ulog.WithWriter(&buffer).WithClock(func() time.Time { return now }).
+		WithHook(ulog.NewOTelHook(&exp)).With("service", "api")
+
+	logger.Write("exported", "n", 42, "ok", true, "tags", []string{"a"})
+	require.Len(t, exp.records, 1)
+	rec := exp.records[0]
+	require.Equal(t, now, rec.Timestamp)
+	require.Equal(t, "exported", rec.Body)
+	require.Equal(t, []ulog.KV{
+		{Key: "service", Value: "api"},
+		{Key: "n", Value: float64(42)},
+		{Key: "ok", Value: true},
+		{Key: "tags", Value: []interface{}{"a"}},
+	}, rec.Attributes)
+	require.NotZero(t, buffer.Len())
+}
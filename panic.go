@@ -0,0 +1,28 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import "errors"
+
+// PanicStackKey is the key of the call stack written by Panic.
+const PanicStackKey = "stack"
+
+// WithPanicError returns a copy of the ULog instance whose Panic panics with an error
+// (with the message as its text) instead of the message string.
+func (u ULog) WithPanicError() ULog {
+	v := u
+	v.panicError = true
+	return v
+}
+
+// Panic writes msg with the fields and the call stack (under PanicStackKey), and then panics with msg
+// (or with an error, see WithPanicError) - so the structured line is always written before the panic.
+func (u ULog) Panic(msg string, fields ...Field) {
+	u.Write(msg, append(append(make([]Field, 0, len(fields)+2), fields...), PanicStackKey, callerStack(maxCallerDepth))...)
+	if u.panicError {
+		panic(errors.New(msg))
+	}
+	panic(msg)
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+// +build protobuf
+
+package ulog
+
+import (
+	stdjson "encoding/json"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Build with the "protobuf" tag to have proto.Message field values encoded with protojson.
+func init() {
+	convertMessage = func(v interface{}) (interface{}, bool) {
+		m, ok := v.(proto.Message)
+		if !ok {
+			return nil, false
+		}
+		b, err := protojson.Marshal(m)
+		if err != nil {
+			return err, true
+		}
+		return stdjson.RawMessage(b), true
+	}
+}
@@ -0,0 +1,30 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+// +build protobuf
+
+package ulog_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestProtoMessage(t *testing.T) {
+	st, err := structpb.NewStruct(map[string]interface{}{"name": "Jim", "age": 42})
+	require.NoError(t, err)
+	ts := timestamppb.New(time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC))
+
+	var buffer bytes.Buffer
+	ulog.WithWriter(&buffer).Write("this is a test", "struct", st, "ts_field", ts)
+	logLine := parseLogLine(buffer.Bytes())
+	require.Equal(t, map[string]interface{}{"name": "Jim", "age": float64(42)}, logLine["struct"])
+	require.Equal(t, "2021-02-03T04:05:06Z", logLine["ts_field"])
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// RingWriter is an io.Writer which keeps the last few lines in memory.
+//
+// Useful for serving recent activity, without touching the disk.
+type RingWriter struct {
+	mu    sync.Mutex
+	lines []string
+	next  int
+	full  bool
+}
+
+// NewRingWriter returns a RingWriter which keeps the last capacity lines.
+func NewRingWriter(capacity int) *RingWriter {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &RingWriter{lines: make([]string, capacity)}
+}
+
+// Write the lines of p into the ring, evicting the oldest ones.
+func (rw *RingWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	rw.mu.Lock()
+	for len(p) != 0 {
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line, p = p[:i], p[i+1:]
+		} else {
+			p = nil
+		}
+		if len(line) == 0 {
+			continue
+		}
+		rw.lines[rw.next] = string(line)
+		if rw.next++; rw.next == len(rw.lines) {
+			rw.next, rw.full = 0, true
+		}
+	}
+	rw.mu.Unlock()
+	return n, nil
+}
+
+// Lines returns the kept lines, oldest first, without the line terminators.
+func (rw *RingWriter) Lines() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.full {
+		return append([]string(nil), rw.lines[:rw.next]...)
+	}
+	return append(append(make([]string, 0, len(rw.lines)), rw.lines[rw.next:]...), rw.lines[:rw.next]...)
+}
+
+// NewReader returns an io.Reader over a snapshot of the kept lines, oldest first,
+// each terminated by a newline - such as the body of a /debug/logs response.
+func (rw *RingWriter) NewReader() io.Reader {
+	lines := rw.Lines()
+	n := 0
+	for _, line := range lines {
+		n += len(line) + 1
+	}
+	var sb strings.Builder
+	sb.Grow(n)
+	for _, line := range lines {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return strings.NewReader(sb.String())
+}
+
+// Last returns the last line written, or "" if nothing has been written yet.
+func (rw *RingWriter) Last() string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.full && rw.next == 0 {
+		return ""
+	}
+	i := rw.next - 1
+	if i < 0 {
+		i = len(rw.lines) - 1
+	}
+	return rw.lines[i]
+}
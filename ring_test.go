@@ -0,0 +1,56 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingWriter(t *testing.T) {
+	rw := ulog.NewRingWriter(3)
+	require.Empty(t, rw.Lines())
+	require.Equal(t, "", rw.Last())
+
+	logger := ulog.WithWriter(rw)
+	for i := 0; i < 5; i++ {
+		logger.Write(strconv.Itoa(i))
+	}
+
+	lines := rw.Lines()
+	require.Len(t, lines, 3)
+	for i, line := range lines {
+		require.Equal(t, strconv.Itoa(i+2), parseLogLine([]byte(line))[ulog.DefaultMessageKey])
+	}
+	require.Equal(t, lines[2], rw.Last())
+
+	b, err := ioutil.ReadAll(rw.NewReader())
+	require.NoError(t, err)
+	require.Equal(t, strings.Join(lines, "\n")+"\n", string(b))
+}
+
+func TestRingWriterConcurrent(t *testing.T) {
+	rw := ulog.NewRingWriter(10)
+	logger := ulog.WithWriter(rw)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.Write("concurrent")
+				rw.Lines()
+			}
+		}()
+	}
+	wg.Wait()
+	require.Len(t, rw.Lines(), 10)
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// FlushOnSignal installs a signal handler which flushes the logger's writer on any of sigs,
+// then re-raises the signal with the default handling - so buffered lines are not lost on SIGTERM.
+//
+// The writer is flushed with its Flush() error method, then synced with its Sync() error method,
+// if it has those.
+//
+// The returned function removes the handler.
+func (u ULog) FlushOnSignal(sigs ...os.Signal) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go u.flushOnSignal(ch, done, func(sig os.Signal) {
+		signal.Stop(ch)
+		if p, err := os.FindProcess(os.Getpid()); err == nil {
+			_ = p.Signal(sig)
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+func (u ULog) flushOnSignal(ch <-chan os.Signal, done <-chan struct{}, reraise func(os.Signal)) {
+	select {
+	case sig := <-ch:
+		_ = flushWriter(u.Writer)
+		reraise(sig)
+	case <-done:
+	}
+}
+
+// flushWriter flushes and syncs w, if it supports those.
+func flushWriter(w io.Writer) error {
+	if f, ok := w.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
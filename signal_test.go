@@ -0,0 +1,39 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestFlushOnSignal(t *testing.T) {
+	var buffer bytes.Buffer
+	bw := bufio.NewWriterSize(&buffer, 4096)
+	logger := WithWriter(bw)
+	logger.Write("buffered")
+	if buffer.Len() != 0 {
+		t.Fatal("not buffered")
+	}
+
+	ch := make(chan os.Signal, 1)
+	reraised := make(chan os.Signal, 1)
+	go logger.flushOnSignal(ch, nil, func(sig os.Signal) { reraised <- sig })
+	ch <- syscall.SIGTERM
+	if sig := <-reraised; sig != syscall.SIGTERM {
+		t.Errorf("got %v reraised, wanted SIGTERM", sig)
+	}
+	if !strings.Contains(buffer.String(), `"msg": "buffered"`) {
+		t.Errorf("not flushed: %q", buffer.String())
+	}
+
+	stop := logger.FlushOnSignal(syscall.SIGTERM)
+	stop()
+	stop()
+}
@@ -8,13 +8,67 @@ import (
 	"context"
 	"io"
 	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-var uLog = New()
+var uLog = func() ULog { u := New(); u.Writer = globalWriter{}; return u }()
+
+// globalOutput holds the writer of the standard ULog instance, set by SetOutput.
+var globalOutput atomic.Value
+
+type writerBox struct{ io.Writer }
+
+// globalWriter writes to the writer set by SetOutput, or DefaultWriter.
+type globalWriter struct{}
+
+func (globalWriter) Write(p []byte) (int, error) {
+	if b, ok := globalOutput.Load().(writerBox); ok && b.Writer != nil {
+		return b.Writer.Write(p)
+	}
+	return DefaultWriter.Write(p)
+}
+
+// SetOutput sets the output of the standard ULog instance (and all the loggers derived from it with With), like log.SetOutput.
+//
+// A nil w restores DefaultWriter.
+func SetOutput(w io.Writer) {
+	globalOutput.Store(writerBox{w})
+}
+
+var (
+	// globalFields holds the []dynamicField registered by RegisterGlobalField.
+	globalFields   atomic.Value
+	globalFieldsMu sync.Mutex
+)
+
+// RegisterGlobalField registers fn to be evaluated on every Write of every logger,
+// and its result included under key - such as the deployment version, or a feature flag state.
+//
+// Registering a key again replaces its fn; a nil fn unregisters the key.
+// The dynamic fields of the logger and the fields of the actual Write call override the global fields.
+func RegisterGlobalField(key string, fn func() interface{}) {
+	globalFieldsMu.Lock()
+	defer globalFieldsMu.Unlock()
+	old, _ := globalFields.Load().([]dynamicField)
+	fields := make([]dynamicField, 0, len(old)+1)
+	for _, d := range old {
+		if d.key != key {
+			fields = append(fields, d)
+		}
+	}
+	if fn != nil {
+		fields = append(fields, dynamicField{key: key, fn: fn})
+	}
+	globalFields.Store(fields)
+}
 
 // WithWriter returns a copy of the standard ULog instance configured to write to the given writer
 func WithWriter(w io.Writer) ULog {
-	return ULog{Writer: w, MessageKey: DefaultMessageKey, TimestampKey: DefaultTimestampKey}
+	return ULog{Writer: w, MessageKey: DefaultMessageKey, TimestampKey: DefaultTimestampKey,
+		stats: new(stats)}
 }
 
 // With returns a copy of the standard ULog instance configured with the provided fields
@@ -37,14 +91,51 @@ func Log(keyvals ...interface{}) error {
 	return uLog.Log(keyvals...)
 }
 
+// CaptureStandardLog redirects the output of the standard library's log package
+// through the standard ULog instance (see StdLogWriter), so each log.Print writes a structured line.
+//
+// The returned func restores the previous output and flags of the log package.
+func CaptureStandardLog() (restore func()) {
+	w, flags := log.Writer(), log.Flags()
+	log.SetOutput(uLog.StdLogWriter())
+	log.SetFlags(0)
+	return func() {
+		log.SetOutput(w)
+		log.SetFlags(flags)
+	}
+}
+
+// StdLogWriter returns an io.Writer which writes what it gets (a line of a log.Logger)
+// as the message of a line of u - for log.SetOutput or log.New.
+func (u ULog) StdLogWriter() io.Writer { return stdLogWriter{u: u} }
+
+type stdLogWriter struct{ u ULog }
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	w.u.Write(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
 // WithContext returns a Context, storing the default ULog in it.
 func WithContext(ctx context.Context) context.Context {
 	return uLog.WithContext(ctx)
 }
 
-// WithContext returns a Context, storing the ULog in int.
+// WithContext returns a Context, storing the ULog in it.
 func (u ULog) WithContext(ctx context.Context) context.Context {
-	return context.WithValue(ctx, logCtxKey{}, uLog)
+	return context.WithValue(ctx, logCtxKey{}, u)
+}
+
+// GoContext returns a fresh Context, detached from the cancellation and values of ctx,
+// carrying a Clone of the ULog stored in ctx - for a long-running goroutine spawned from a request.
+func GoContext(ctx context.Context) context.Context {
+	return FromContext(ctx).Clone().WithContext(context.Background())
+}
+
+// ContextWith returns a Context carrying the ULog of ctx (see FromContext) with the fields added,
+// for a sub-scope of the request.
+func ContextWith(ctx context.Context, fields ...Field) context.Context {
+	return FromContext(ctx).With(fields...).WithContext(ctx)
 }
 
 // FromContext returns the ULog from the Context,
@@ -0,0 +1,189 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"encoding"
+	stdjson "encoding/json"
+	"reflect"
+	"strings"
+)
+
+// WithStruct returns a copy of the ULog instance with the exported fields of the struct v
+// (or pointer to struct) as top-level fields, named as encoding/json would name them:
+// the `json:"-"` fields are skipped, and so are the empty `json:",omitempty"` ones.
+// The fields of the embedded structs are flattened, too.
+//
+// Anything else (including a nil pointer) returns u unchanged.
+func (u ULog) WithStruct(v interface{}) ULog {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return u
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return u
+	}
+	fields := appendStructFields(nil, rv)
+	if len(fields) == 0 {
+		return u
+	}
+	return u.With(fields...)
+}
+
+func appendStructFields(fields []Field, rv reflect.Value) []Field {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j:]
+		}
+		fv := rv.Field(i)
+		if sf.Anonymous && name == "" {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				fields = appendStructFields(fields, fv)
+				continue
+			}
+			// A nil embedded pointer to struct is skipped, as by encoding/json.
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				continue
+			}
+		}
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		if strings.Contains(opts, ",omitempty") && isEmptyValue(fv) {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, name, fv.Interface())
+	}
+	return fields
+}
+
+// valueChange is an entry of StructDiff.
+type valueChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// StructDiff returns a field (usable in the place of a key and value) with the changed exported fields
+// of the structs (or pointers to structs) before and after as {"name": {"old": x, "new": y}} under key,
+// the fields named as with WithStruct - for audit logs.
+//
+// Nested structs are compared field by field for one level (as "outer.inner"), deeper as a whole.
+// If before and after are not structs of the same type, the whole values are compared.
+func StructDiff(key string, before, after interface{}) Field {
+	a, b := indirectValue(reflect.ValueOf(before)), indirectValue(reflect.ValueOf(after))
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() || !isPlainStruct(a.Type()) {
+		diff := OrderedMap{}
+		if !reflect.DeepEqual(before, after) {
+			diff = OrderedMap{{Key: "old", Value: before}, {Key: "new", Value: after}}
+		}
+		return WhenAll(true, key, diff)
+	}
+	return WhenAll(true, key, appendStructDiff(OrderedMap{}, "", a, b, 1))
+}
+
+// indirectValue dereferences the pointers of rv, returning the zero Value for a nil pointer.
+func indirectValue(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return reflect.Value{}
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*stdjson.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isPlainStruct reports whether t is a struct with exported fields, which is not a (JSON or text) Marshaler -
+// so it is encoded as its fields, as with time.Time.
+func isPlainStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	if pt.Implements(jsonMarshalerType) || pt.Implements(textMarshalerType) {
+		return false
+	}
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// appendStructDiff appends the differing fields of the structs a and b (of the same type),
+// recursing into the nested structs for depth levels.
+func appendStructDiff(diff OrderedMap, prefix string, a, b reflect.Value, depth int) OrderedMap {
+	rt := a.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name = tag[:j]
+		}
+		av, bv := a.Field(i), b.Field(i)
+		if sf.Anonymous && name == "" && av.Kind() == reflect.Struct {
+			diff = appendStructDiff(diff, prefix, av, bv, depth)
+			continue
+		}
+		if sf.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		if depth > 0 && isPlainStruct(av.Type()) {
+			diff = appendStructDiff(diff, prefix+name+".", av, bv, depth-1)
+			continue
+		}
+		if x, y := av.Interface(), bv.Interface(); !reflect.DeepEqual(x, y) {
+			diff = append(diff, KV{Key: prefix + name, Value: valueChange{Old: x, New: y}})
+		}
+	}
+	return diff
+}
+
+// isEmptyValue is the omitempty test of encoding/json.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -4,13 +4,28 @@
 
 package ulog
 
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+)
+
 type testLogger interface {
 	Log(...interface{})
 }
 
+// testFailer is the part of testing.TB used by AssertLogged and BoundedTestWriter,
+// so that the production binaries do not link the testing package.
+type testFailer interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
 func NewTestLogger(t testLogger) ULog {
 	return ULog{TimestampKey: DefaultTimestampKey, MessageKey: DefaultMessageKey,
-		Writer: testLogWriter{t}}
+		Writer: testLogWriter{t}, stats: new(stats)}
 }
 
 type testLogWriter struct {
@@ -24,3 +39,92 @@ func (tw testLogWriter) Write(p []byte) (int, error) {
 	tw.Log(string(p))
 	return len(p), nil
 }
+
+// AssertLogged checks that at least one of the entries (as decoded from the log lines, e.g. by Decoder)
+// has the message msg (under DefaultMessageKey) and contains all the fields, and fails t if not.
+// The other fields of the entries are ignored.
+//
+// The field values are compared by their JSON representation, so 1 matches 1.0.
+func AssertLogged(t testFailer, entries []map[string]interface{}, msg string, fields map[string]interface{}) bool {
+	t.Helper()
+	want := make(map[string]interface{}, len(fields))
+	for k, v := range fields {
+		want[k] = normalizeJSON(v)
+	}
+Entries:
+	for _, e := range entries {
+		if m, _ := e[DefaultMessageKey].(string); m != msg {
+			continue
+		}
+		for k, v := range want {
+			got, ok := e[k]
+			if !ok || !reflect.DeepEqual(normalizeJSON(got), v) {
+				continue Entries
+			}
+		}
+		return true
+	}
+	t.Errorf("no entry with message %q and fields %v in %v", msg, fields, entries)
+	return false
+}
+
+// normalizeJSON returns v as decoded from its JSON encoding.
+func normalizeJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var n interface{}
+	if err := json.Unmarshal(b, &n); err != nil {
+		return v
+	}
+	return n
+}
+
+// BoundedTestWriter is an in-memory sink for tests, which fails the test
+// when more than its bound is written to it - catching accidental log explosions.
+type BoundedTestWriter struct {
+	t       testFailer
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	max     int
+	written int
+}
+
+// NewBoundedTestWriter returns a BoundedTestWriter which fails t if more than max bytes are written.
+func NewBoundedTestWriter(t testFailer, max int) *BoundedTestWriter {
+	return &BoundedTestWriter{t: t, max: max}
+}
+
+// Write captures the lines of p that fit in the bound, and fails the test (once) on overflow.
+func (bw *BoundedTestWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	overflow := bw.written <= bw.max && bw.written+len(p) > bw.max
+	bw.written += len(p)
+	if bw.written <= bw.max {
+		bw.buf.Write(p)
+	} else if overflow {
+		bw.t.Helper()
+		bw.t.Errorf("log output exceeded %d bytes", bw.max)
+	}
+	return len(p), nil
+}
+
+// Written returns the total number of bytes written, including the ones over the bound.
+func (bw *BoundedTestWriter) Written() int {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.written
+}
+
+// Lines returns the captured lines (the ones that fit in the bound).
+func (bw *BoundedTestWriter) Lines() []string {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	s := strings.TrimSuffix(bw.buf.String(), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
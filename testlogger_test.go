@@ -0,0 +1,73 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+// failRecorder records the failures instead of failing the test.
+type failRecorder struct {
+	testing.TB
+	failures []string
+}
+
+func (fr *failRecorder) Helper() {}
+func (fr *failRecorder) Errorf(format string, args ...interface{}) {
+	fr.failures = append(fr.failures, fmt.Sprintf(format, args...))
+}
+
+func TestAssertLogged(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := ulog.WithWriter(&buffer)
+	logger.Write("first", "a", 1)
+	logger.Write("second", "a", 2, "b", "x", "c", []int{1, 2})
+
+	var entries []map[string]interface{}
+	dec := ulog.NewDecoder(&buffer)
+	for {
+		e, err := dec.Decode()
+		if err != nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	require.Len(t, entries, 2)
+
+	require.True(t, ulog.AssertLogged(t, entries, "second", map[string]interface{}{"a": 2, "c": []int{1, 2}}))
+	require.True(t, ulog.AssertLogged(t, entries, "first", nil))
+
+	fr := &failRecorder{TB: t}
+	require.False(t, ulog.AssertLogged(fr, entries, "first", map[string]interface{}{"b": "x"}))
+	require.False(t, ulog.AssertLogged(fr, entries, "third", nil))
+	require.Len(t, fr.failures, 2)
+	require.Contains(t, fr.failures[0], `"first"`)
+}
+
+func TestBoundedTestWriter(t *testing.T) {
+	fr := &failRecorder{TB: t}
+	bw := ulog.NewBoundedTestWriter(fr, 200)
+	logger := ulog.WithWriter(bw)
+
+	logger.Write("first")
+	logger.Write("second")
+	require.Empty(t, fr.failures)
+	require.Len(t, bw.Lines(), 2)
+
+	for i := 0; i < 10; i++ {
+		logger.Write("explosion")
+	}
+	require.Len(t, fr.failures, 1)
+	require.Contains(t, fr.failures[0], "200")
+	require.True(t, bw.Written() > 200)
+	lines := bw.Lines()
+	require.True(t, len(lines) >= 2 && len(lines) < 12, "%d", len(lines))
+	require.Equal(t, "second", parseLogLine([]byte(lines[1]))[ulog.DefaultMessageKey])
+}
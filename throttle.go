@@ -0,0 +1,66 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"sync"
+	"time"
+)
+
+// SuppressedKey is the key of the number of suppressed lines, see ULog.WithThrottle.
+const SuppressedKey = "suppressed"
+
+type throttle struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]*throttleState
+	lastSweep time.Time
+}
+
+type throttleState struct {
+	last       time.Time
+	suppressed int
+}
+
+// allow reports whether msg can be emitted at now,
+// and how many lines have been suppressed since the last emission.
+func (t *throttle) allow(msg string, now time.Time) (int, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sweep(now)
+	st := t.seen[msg]
+	if st == nil {
+		t.seen[msg] = &throttleState{last: now}
+		return 0, true
+	}
+	if now.Sub(st.last) < t.interval {
+		st.suppressed++
+		return 0, false
+	}
+	n := st.suppressed
+	st.last, st.suppressed = now, 0
+	return n, true
+}
+
+// keepSuppressed is the number of intervals a message with suppressed lines is kept for,
+// waiting for its next emission to report the count.
+const keepSuppressed = 10
+
+// sweep evicts the messages last emitted more than an interval ago (or keepSuppressed intervals,
+// if there are suppressed lines to report), at most once per interval,
+// to keep the memory bounded with interpolated messages. Must be called with mu held.
+func (t *throttle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.interval {
+		return
+	}
+	t.lastSweep = now
+	for msg, st := range t.seen {
+		if age := now.Sub(st.last); st.suppressed == 0 && age >= t.interval ||
+			age >= keepSuppressed*t.interval {
+			delete(t.seen, msg)
+		}
+	}
+}
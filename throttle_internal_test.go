@@ -0,0 +1,25 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestThrottleEviction(t *testing.T) {
+	th := &throttle{interval: time.Minute, seen: make(map[string]*throttleState)}
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		if _, ok := th.allow("request "+strconv.Itoa(i), now); !ok {
+			t.Fatalf("%d. distinct message suppressed", i)
+		}
+		now = now.Add(time.Second)
+	}
+	if n := len(th.seen); n > 2*60 {
+		t.Errorf("got %d kept messages, wanted at most %d", n, 2*60)
+	}
+}
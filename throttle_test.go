@@ -0,0 +1,44 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottle(t *testing.T) {
+	var buffer bytes.Buffer
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := ulog.WithWriter(&buffer).
+		WithClock(func() time.Time { return now }).
+		WithThrottle(time.Minute)
+
+	for i := 0; i < 3; i++ {
+		logger.Write("chatty")
+		now = now.Add(time.Second)
+	}
+	logger.Write("other")
+	now = now.Add(time.Minute)
+	logger.Write("chatty")
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&buffer)
+	for scanner.Scan() {
+		lines = append(lines, parseLogLine(scanner.Bytes()))
+	}
+	require.Len(t, lines, 3)
+	require.Equal(t, "chatty", lines[0][ulog.DefaultMessageKey])
+	require.NotContains(t, lines[0], ulog.SuppressedKey)
+	require.Equal(t, "other", lines[1][ulog.DefaultMessageKey])
+	require.Equal(t, "chatty", lines[2][ulog.DefaultMessageKey])
+	require.EqualValues(t, 2, lines[2][ulog.SuppressedKey])
+	require.Equal(t, now, parseTime(lines[2][ulog.DefaultTimestampKey]))
+}
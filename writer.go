@@ -0,0 +1,233 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+// WriteSyncer is an io.Writer which can flush its contents to stable storage, such as *os.File.
+type WriteSyncer interface {
+	io.Writer
+	Sync() error
+}
+
+// NewSyncOnLevelWriter returns an io.Writer which calls f.Sync after writing
+// a line whose level (under levelKey, DefaultLevelKey if empty) is at least triggerLevel.
+//
+// This guarantees that error lines hit the disk before a subsequent crash.
+func NewSyncOnLevelWriter(f WriteSyncer, levelKey string, triggerLevel Level) io.Writer {
+	if levelKey == "" {
+		levelKey = DefaultLevelKey
+	}
+	return syncOnLevelWriter{f: f, levelKey: levelKey, trigger: triggerLevel}
+}
+
+type syncOnLevelWriter struct {
+	f        WriteSyncer
+	levelKey string
+	trigger  Level
+}
+
+func (w syncOnLevelWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if lineLevel(p, w.levelKey) >= w.trigger {
+		err = w.f.Sync()
+	}
+	return n, err
+}
+
+// NewSplit returns a ULog which writes the lines with at least Error level (under levelKey) to errw,
+// and everything else to normal.
+func NewSplit(levelKey string, normal, errw io.Writer) ULog {
+	if levelKey == "" {
+		levelKey = DefaultLevelKey
+	}
+	return WithWriter(splitWriter{levelKey: levelKey, normal: normal, errw: errw}).
+		WithLevelKey(levelKey)
+}
+
+type splitWriter struct {
+	levelKey     string
+	normal, errw io.Writer
+}
+
+func (w splitWriter) Write(p []byte) (int, error) {
+	if lineLevel(p, w.levelKey) >= Error {
+		return w.errw.Write(p)
+	}
+	return w.normal.Write(p)
+}
+
+// WithBufferedWriter returns a copy of the ULog instance which writes through a bufio.Writer
+// of size bytes (wrapping its Writer, or DefaultWriter), and the func to flush it - defer that!
+//
+// The new Writer has Flush, Sync and Close methods (so FlushOnSignal flushes it, too),
+// which flush the buffer first, then chain to the wrapped writer, if it supports them.
+func (u ULog) WithBufferedWriter(size int) (ULog, func() error) {
+	w := u.Writer
+	if w == nil {
+		w = DefaultWriter
+	}
+	bw := &bufferedWriter{w: w, buf: bufio.NewWriterSize(w, size)}
+	v := u
+	v.Writer = bw
+	return v, bw.Flush
+}
+
+type bufferedWriter struct {
+	w   io.Writer
+	mu  sync.Mutex
+	buf *bufio.Writer
+}
+
+func (bw *bufferedWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.buf.Write(p)
+}
+
+// Flush the buffer.
+func (bw *bufferedWriter) Flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.buf.Flush()
+}
+
+// Sync flushes the buffer, then syncs the wrapped writer.
+func (bw *bufferedWriter) Sync() error {
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return flushWriter(bw.w)
+}
+
+// Close flushes the buffer, then closes the wrapped writer.
+func (bw *bufferedWriter) Close() error {
+	err := bw.Sync()
+	if c, ok := bw.w.(io.Closer); ok {
+		if closeErr := c.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Flusher is implemented by the writers which buffer their output,
+// such as the Writer of WithBufferedWriter.
+type Flusher interface {
+	Flush() error
+}
+
+// NewRotatingWriter returns a writer which writes to a writer returned by open,
+// and replaces it by a freshly opened one (rotates) when maxBytes (if positive) would be exceeded, or on Rotate.
+//
+// The rotation happens only between lines, so no line is split across the writers
+// (even if a buffer, such as WithBufferedWriter, passes the lines in chunks).
+// On rotation, the old writer is flushed if it is a Flusher, and after opening the new one,
+// closed if it is an io.Closer.
+func NewRotatingWriter(open func() (io.Writer, error), maxBytes int64) (*RotatingWriter, error) {
+	w, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &RotatingWriter{open: open, maxBytes: maxBytes, w: w}, nil
+}
+
+// RotatingWriter is the writer returned by NewRotatingWriter.
+type RotatingWriter struct {
+	open     func() (io.Writer, error)
+	w        io.Writer
+	mu       sync.Mutex
+	maxBytes int64
+	written  int64
+	// midLine is true iff the last Write did not end a line.
+	midLine bool
+	// pending is true iff a rotation waits for the end of the line.
+	pending bool
+}
+
+func (rw *RotatingWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if !rw.midLine && rw.maxBytes > 0 && rw.written != 0 && rw.written+int64(len(p)) > rw.maxBytes {
+		if err := rw.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rw.w.Write(p)
+	rw.written += int64(n)
+	if n != 0 {
+		rw.midLine = p[n-1] != '\n'
+	}
+	if err == nil && rw.pending && !rw.midLine {
+		err = rw.rotate()
+	}
+	return n, err
+}
+
+// Rotate to a new writer - right now, or after the end of the current line.
+func (rw *RotatingWriter) Rotate() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.midLine {
+		rw.pending = true
+		return nil
+	}
+	return rw.rotate()
+}
+
+// Flush the current writer, if it is a Flusher.
+func (rw *RotatingWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if f, ok := rw.w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Close flushes and closes the current writer.
+func (rw *RotatingWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return closeWriter(rw.w)
+}
+
+func (rw *RotatingWriter) rotate() error {
+	if f, ok := rw.w.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	w, err := rw.open()
+	if err != nil {
+		return err
+	}
+	old := rw.w
+	rw.w, rw.written, rw.pending = w, 0, false
+	if c, ok := old.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// closeWriter flushes w if it is a Flusher, then closes it if it is an io.Closer.
+func closeWriter(w io.Writer) error {
+	if f, ok := w.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+	if c, ok := w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2021 Tamás Gulácsi.
+//
+// SPDX-License-Identifier: MIT
+
+package ulog_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/UNO-SOFT/ulog"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSyncer struct {
+	bytes.Buffer
+	syncs int
+}
+
+func (f *fakeSyncer) Sync() error { f.syncs++; return nil }
+
+func TestSyncOnLevelWriter(t *testing.T) {
+	var f fakeSyncer
+	logger := ulog.WithWriter(ulog.NewSyncOnLevelWriter(&f, "", ulog.Error))
+
+	logger.WithLevel(ulog.Info).Write("info")
+	logger.Write("no level", "text", `"level": "error"`)
+	require.Equal(t, 0, f.syncs)
+
+	logger.WithLevel(ulog.Error).Write("error")
+	require.Equal(t, 1, f.syncs)
+	require.Contains(t, f.String(), `"msg": "error"`)
+
+	f = fakeSyncer{}
+	logger = ulog.WithWriter(ulog.NewSyncOnLevelWriter(&f, "severity", ulog.Warn)).WithLevelKey("severity")
+	logger.WithLevel(ulog.Info).Write("info")
+	require.Equal(t, 0, f.syncs)
+	logger.WithLevel(ulog.Error).Write("error")
+	require.Equal(t, 1, f.syncs)
+}
+
+func TestNewSplit(t *testing.T) {
+	var normal, errw bytes.Buffer
+	logger := ulog.NewSplit("severity", &normal, &errw)
+
+	logger.WithLevel(ulog.Error).Write("failure")
+	logger.WithLevel(ulog.Info).Write("success")
+	logger.Write("no level")
+
+	require.Contains(t, errw.String(), "failure")
+	require.NotContains(t, errw.String(), "success")
+	require.Contains(t, normal.String(), `"severity": "info"`)
+	require.Contains(t, normal.String(), "no level")
+	require.NotContains(t, normal.String(), "failure")
+}
+
+func TestWithBufferedWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	logger, flush := ulog.WithWriter(&buffer).WithBufferedWriter(64 << 10)
+
+	for i := 0; i < 100; i++ {
+		logger.Write("buffered", "i", i)
+	}
+	require.Zero(t, buffer.Len(), "nothing should be written before flush")
+	require.NoError(t, flush())
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	require.Len(t, lines, 100)
+	require.EqualValues(t, 99, parseLogLine([]byte(lines[99]))["i"])
+
+	// Sync chains to the wrapped writer.
+	fs := &fakeSyncer{}
+	logger, _ = ulog.WithWriter(fs).WithBufferedWriter(1024)
+	logger.Write("synced")
+	require.NoError(t, logger.Writer.(ulog.WriteSyncer).Sync())
+	require.Equal(t, 1, fs.syncs)
+	require.Contains(t, fs.String(), "synced")
+}
+
+// flushRecorder is a buffered file, recording whether it was flushed before closing.
+type flushRecorder struct {
+	pending         int
+	flushed, closed bool
+}
+
+func (f *flushRecorder) Write(p []byte) (int, error) { f.pending += len(p); return len(p), nil }
+func (f *flushRecorder) Flush() error                { f.flushed = f.pending != 0; f.pending = 0; return nil }
+func (f *flushRecorder) Close() error                { f.closed = true; return nil }
+
+func TestRotatingWriter(t *testing.T) {
+	var files []*bytes.Buffer
+	rw, err := ulog.NewRotatingWriter(func() (io.Writer, error) {
+		files = append(files, &bytes.Buffer{})
+		return files[len(files)-1], nil
+	}, 1024)
+	require.NoError(t, err)
+	// The small buffer passes the lines in chunks.
+	logger, flush := ulog.WithWriter(rw).WithBufferedWriter(100)
+
+	const n = 50
+	for i := 0; i < n; i++ {
+		logger.Write("interleaved with the rotations", "i", i, "padding", strings.Repeat("x", i))
+		if i%7 == 3 {
+			require.NoError(t, rw.Rotate())
+		}
+	}
+	require.NoError(t, flush())
+	require.True(t, len(files) > n/7, "%d files", len(files))
+
+	var i int
+	for j, f := range files {
+		require.True(t, f.Len() <= 1024+100, "%d. file is %d bytes", j, f.Len())
+		if f.Len() == 0 {
+			continue
+		}
+		require.True(t, bytes.HasSuffix(f.Bytes(), []byte("\n")), "%d. file ends mid-line: %q", j, f.String())
+		for _, line := range strings.Split(strings.TrimSuffix(f.String(), "\n"), "\n") {
+			require.EqualValues(t, i, parseLogLine([]byte(line))["i"], "%d. file: %q", j, line)
+			i++
+		}
+	}
+	require.Equal(t, n, i)
+}
+
+func TestRotatingWriterFlushes(t *testing.T) {
+	var files []*flushRecorder
+	rw, err := ulog.NewRotatingWriter(func() (io.Writer, error) {
+		files = append(files, &flushRecorder{})
+		return files[len(files)-1], nil
+	}, 0)
+	require.NoError(t, err)
+	ulog.WithWriter(rw).Write("before rotation")
+	require.NoError(t, rw.Rotate())
+	require.Len(t, files, 2)
+	require.True(t, files[0].flushed)
+	require.True(t, files[0].closed)
+
+	// A partial line defers the rotation till its end.
+	_, err = rw.Write([]byte("{ partial"))
+	require.NoError(t, err)
+	require.NoError(t, rw.Rotate())
+	require.Len(t, files, 2)
+	_, err = rw.Write([]byte(" }\n"))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+	require.NoError(t, rw.Close())
+	require.True(t, files[2].closed)
+}